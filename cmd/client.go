@@ -3,45 +3,89 @@ package main
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"github.com/opencontainers/go-digest"
 	log "github.com/sirupsen/logrus"
 	"github.com/wadeling/clair-client/pkg/clair"
 	"github.com/wadeling/clair-client/pkg/fileserver"
-	_ "github.com/wadeling/clair-client/pkg/model"
+	"github.com/wadeling/clair-client/pkg/config"
+	"github.com/wadeling/clair-client/pkg/logging"
+	"github.com/wadeling/clair-client/pkg/metrics"
+	"github.com/wadeling/clair-client/pkg/model"
+	"github.com/wadeling/clair-client/pkg/progress"
 	"github.com/wadeling/clair-client/pkg/registry-wrap"
+	"github.com/wadeling/clair-client/pkg/report"
+	"github.com/wadeling/clair-client/pkg/retry"
+	"github.com/wadeling/clair-client/pkg/source"
+	"github.com/wadeling/clair-client/pkg/tracing"
+	"go.opentelemetry.io/otel/attribute"
+	"io"
 	"io/ioutil"
-	"sort"
+	"os"
 	"time"
 )
 
+const (
+	// open the breaker after this many consecutive clair failures and probe again after the timeout
+	clairBreakerThreshold = 5
+	clairBreakerTimeout   = 30 * time.Second
+
+	// cache label of the metrics of images found scanned in clair
+	clairResultCache = "clair_result"
+)
+
 type ClairClient struct {
-	clairServerIP 		string
-	clairServerPort 	int
-	username string
-	password string
-	registryUrl string
-	repository string
-	imageName string
-	tagName string
+	cfg *config.Config
+	clairAuth clair.Authenticator
 	fullRepoName string
 	registryClient *registryWrap.RegistryClient
-	action string
+	// hostCredentials uses only the docker config credentials of the registry host,
+	// for registries other than the configured one
+	hostCredentials bool
+	source source.ImageSource
 
 	imageDigest digest.Digest
 	layers []string
 	client *clair.Client
+	ctx context.Context
+	scanID string
+	status *clair.ScanStatus
+	cancel context.CancelFunc
 
 	//statistics
 	sta map[string]int		// vuln servirity->num
+	vulnerabilities []model.VulnerabilityInfo
+	packages []model.Package
 
 	fs *fileserver.FileServer
 }
 
+func newClairClient(cfg *config.Config) *ClairClient {
+	return &ClairClient{
+		cfg: cfg,
+		layers: make([]string,0),
+		sta: make(map[string]int),
+	}
+}
+
 func (cc *ClairClient) NewRegistryClient() error {
-	f := fmt.Sprintf("%s/%s",cc.repository,cc.imageName)
+	reg := cc.cfg.Registry
+	f := fmt.Sprintf("%s/%s",reg.Repository,reg.Image)
 	cc.fullRepoName = f
-	client, err := registryWrap.NewRegistryClient(cc.username,cc.password,cc.fullRepoName,cc.registryUrl,true)
+	resolve := func() (registryWrap.Credentials,error) {
+		return registryWrap.ResolveCredentials(reg.URL,reg.Username,reg.Password)
+	}
+	if cc.hostCredentials {
+		resolve = func() (registryWrap.Credentials,error) {
+			return registryWrap.ResolveHostCredentials(reg.URL)
+		}
+	}
+	credentials, err := resolve()
+	if err != nil {
+		return err
+	}
+	client, err := registryWrap.NewRegistryClient(credentials,cc.fullRepoName,reg.URL,reg.Insecure)
 	if err != nil {
 		return err
 	}
@@ -50,159 +94,465 @@ func (cc *ClairClient) NewRegistryClient() error {
 	return nil
 }
 
-func (cc *ClairClient) NewClient() error {
-	ctx,_ := context.WithTimeout(context.Background(),time.Duration(10)*time.Minute)
-	cc.client = &clair.Client{
-		Ctx: ctx,
-		ClairAddr: cc.clairServerIP,
-		ClairPort: cc.clairServerPort,
+// NewClient creates the clair client and the scan context,canceled with ctx or after clair.scanTimeout
+func (cc *ClairClient) NewClient(ctx context.Context) error {
+	cfg := cc.cfg.Clair
+	cc.newScanContext(ctx)
+
+	opts := []clair.Option{
+		clair.WithCACert(cfg.CA),
+		clair.WithClientCert(cfg.Cert,cfg.Key),
+		clair.WithTimeout(cfg.Timeout),
+		clair.WithProxy(cfg.Proxy),
+		clair.WithBreaker(retry.NewBreaker(clairBreakerThreshold,clairBreakerTimeout)),
+		clair.WithAuthenticator(cc.clairAuth),
+	}
+	if cfg.URL != "" {
+		opts = append(opts,clair.WithBaseURL(cfg.URL))
+	} else {
+		opts = append(opts,clair.WithAddr(cfg.IP,cfg.Port))
 	}
+	client,err := clair.NewClient(opts...)
+	if err != nil {
+		return err
+	}
+	cc.client = client
 	return nil
 }
 
-func (cc *ClairClient) PostScanTaskToClair() error {
-	//create new registry client
-	if cc.registryClient == nil {
-		err := cc.NewRegistryClient()
-		if err != nil {
-			return err
+// newScanContext creates the scan context with a logger tagged with a new scan id
+func (cc *ClairClient) newScanContext(ctx context.Context) {
+	cc.scanID = logging.NewScanID()
+	ctx = logging.WithFields(ctx,log.Fields{logging.FieldScanID: cc.scanID})
+	cc.ctx,cc.cancel = context.WithTimeout(ctx,cc.cfg.Clair.ScanTimeout)
+}
+
+// logger is the logger of the scan,see newScanContext
+func (cc *ClairClient) logger() *log.Entry {
+	return logging.FromContext(cc.ctx)
+}
+
+// PostScanTaskToClair posts all image layers to clair and writes the vulnerabilities of the top layer.
+// The returned status tells whether the result is complete.
+func (cc *ClairClient) PostScanTaskToClair() (status *clair.ScanStatus,err error) {
+	metrics.ScansInFlight.Inc()
+	defer metrics.ScansInFlight.Dec()
+
+	// every request of the scan is a child of this span
+	ctx,span := tracing.Start(cc.ctx,"scan")
+	defer func(parent context.Context) {
+		cc.ctx = parent
+		if status != nil {
+			span.SetAttributes(attribute.String("state",string(status.State)))
 		}
-	}
+		tracing.End(span,err)
+	}(cc.ctx)
+	cc.ctx = ctx
 
-	//get image digest
-	dg, err := cc.registryClient.GetManifestDigest(cc.fullRepoName,cc.tagName)
-	cc.imageDigest = dg
-	if err != nil {
-		return err
+	if err := cc.openSource(); err != nil {
+		return nil,err
 	}
-	log.Infof("get image digest %s",dg.String())
+	defer cc.source.Close()
+	span.SetAttributes(attribute.String("image",cc.source.Reference()))
+	cc.ctx = logging.WithFields(cc.ctx,log.Fields{logging.FieldImage: cc.source.Reference()})
 
 	//get layers
-	layers,err := cc.registryClient.GetLayers("v2",cc.fullRepoName,dg.String())
+	layers,err := cc.source.Layers(cc.ctx)
 	if err != nil {
-		return err
+		return nil,err
+	}
+	if rs,ok := cc.source.(*source.RegistrySource); ok {
+		cc.imageDigest = rs.ImageDigest
+		cc.ctx = logging.WithFields(cc.ctx,log.Fields{logging.FieldDigest: rs.ImageDigest.String()})
+		cc.logger().Info("get image digest")
 	}
-	cc.layers = layers
-	log.Infof("get layers %+v",layers)
-
-	//download all layers before fetch vulns,cause need to take a performance for clair
 	for _,layer := range layers {
-		//download blob
-		r,err := cc.registryClient.DownloadBlob(cc.fullRepoName,digest.Digest(layer) )
-		if err != nil {
-			log.Errorf("download layer %s err %v",layer,err)
-			return err
-		}
+		cc.layers = append(cc.layers,layer.Digest)
+	}
+	cc.logger().Infof("get layers %+v",cc.layers)
 
-		// save to file server
-		fp,err := cc.fs.SaveFile(layer,r)
-		if err != nil {
-			log.Errorf("save file err.%v",err)
-			return err
-		}
-		log.Infof("save file to server ok,file path %s",fp)
+	reporter,err := cc.startProgress(layers)
+	if err != nil {
+		return nil,err
+	}
+	defer reporter.Done()
+
+	var requests []clair.LayerRequest
+	if cc.cfg.Registry.Direct {
+		requests,err = cc.directLayerRequests(layers)
+	} else {
+		requests,err = cc.fileServerLayerRequests(layers)
+	}
+	if err != nil {
+		return nil,err
+	}
+	for i := range requests {
+		i := i
+		requests[i].PostedFunc = func(err error) { reporter.Posted(i,err) }
 	}
 
 	//fetch vulnerabilities
 	startTime := time.Now().Unix()
-	log.Infof("start get vulnerabilities,time %v",startTime)
-	var preLayerDigest string
-	for i,layer := range layers {
+	cc.logger().Infof("start get vulnerabilities,time %v",startTime)
 
-		layerHttpPath := fmt.Sprintf("http://%s:%d/%s/%s",cc.fs.ExternalIp,cc.fs.Port,layer,fileserver.LayerFileName)
-		log.Infof("layer http path:%s",layerHttpPath)
+	//post to clair,pre layer is parent layer
+	status = cc.client.ScheduleLayerChain(cc.ctx,requests)
+	cc.status = status
+	cc.checkLayerDownloads(status)
+	switch status.State {
+	case clair.ScanComplete:
+		cc.logger().Infof("all %d layers posted to clair",len(requests))
+	case clair.ScanPartial:
+		cc.logger().Warnf("scan is partial,layers %v failed,result only covers layers up to %s",status.FailedLayers,status.TopLayer)
+	case clair.ScanUnsupportedOS:
+		cc.logger().Warnf("clair does not support the os or package manager of %s",cc.source.Reference())
+		return status,nil
+	default:
+		return status,fmt.Errorf("no layer of %s could be posted to clair",cc.source.Reference())
+	}
 
-		//post to clair
-		if i == 0 {
-			err := cc.client.ScheduleLayerScanInClair(cc.client.Ctx,layerHttpPath,layer,"")
-			if err != nil {
-				log.Errorf("post layer (%d) %s to clair err %v",i,layer,err)
-			} else {
-				log.Infof("post layer (%d) %s to clair ok",i,layer)
-			}
-		} else {
-			//pre layer is parent layer
-			err := cc.client.ScheduleLayerScanInClair(cc.client.Ctx,layerHttpPath,layer,preLayerDigest)
+	//get scan result
+	// only get last(top) layer result which contain all layer's vulnerabilities
+	result, err := cc.client.GetLayerReport(cc.ctx, status.TopLayer)
+	if err != nil {
+		cc.logger().Errorf("get layer %s vuln err %v",status.TopLayer,err)
+		return status,err
+	}
+
+	endTime:= time.Now().Unix()
+	cc.logger().Infof("end get vulnerabilities,time %v",endTime)
+
+	cc.saveResult(result)
+
+	cc.logger().Info("post layer to clair end")
+
+	return status,nil
+}
+
+// startProgress starts reporting the downloads and posts of the layers,
+// the reporter is passed on in cc.ctx
+func (cc *ClairClient) startProgress(layers []source.Layer) (progress.Reporter,error) {
+	reporter,err := progress.New(cc.cfg.Output.Progress,os.Stderr,cc.logger())
+	if err != nil {
+		return nil,err
+	}
+	// clair downloads the layers itself in direct mode
+	var total int64
+	for _,l := range layers {
+		if cc.cfg.Registry.Direct {
+			break
+		}
+		if l.Size < 0 {
+			total = -1
+			break
+		}
+		total += l.Size
+	}
+	reporter.Start(len(layers),total)
+	cc.ctx = progress.WithReporter(cc.ctx,reporter)
+	return reporter,nil
+}
+
+// fileServerLayerRequests saves all layers to the local file server,clair downloads them from there.
+// In streaming mode the layers are only registered and read from the source when clair asks for them.
+func (cc *ClairClient) fileServerLayerRequests(layers []source.Layer) ([]clair.LayerRequest,error) {
+	//download all layers before fetch vulns,cause need to take a performance for clair
+	for _,layer := range layers {
+		if cc.fs.Streaming {
+			layer := layer
+			src := cc.source
+			reporter := progress.FromContext(cc.ctx)
+			err := cc.fs.AddStreamLayer(cc.ctx,layer.Digest,layer.Size,func(ctx context.Context) (io.ReadCloser,error) {
+				r,err := src.OpenLayer(ctx,layer)
+				if err != nil {
+					return nil,err
+				}
+				return progress.NewReader(r,reporter),nil
+			})
 			if err != nil {
-				log.Errorf("post layer (%d) %s (parent:%s) to clair err %v",i,layer,preLayerDigest,err)
-			} else {
-				log.Infof("post layer (%d) %s to clair ok",i,layer)
+				return nil,err
 			}
+			continue
+		}
+
+		if err := cc.saveLayer(layer); err != nil {
+			return nil,err
 		}
-		preLayerDigest = layer
 	}
 
-	//get scan result
-	// only get last(top) layer result which contain all layer's vulnerabilities
-	_, vulnerabilities, err := cc.client.GetTransformedLayerScanResultFromClair(cc.client.Ctx, preLayerDigest)
+	requests := make([]clair.LayerRequest,0,len(layers))
+	for i,layer := range layers {
+		layerHttpPath := cc.fs.LayerURL(layer.Digest)
+		cc.logger().WithFields(log.Fields{logging.FieldLayer: layer.Digest,logging.FieldLayerIndex: i}).Debugf("layer http path:%s",layerHttpPath)
+		requests = append(requests,clair.LayerRequest{Name: layer.Digest,Path: layerHttpPath})
+	}
+	return requests,nil
+}
+
+// saveLayer downloads a layer from the source into the file server
+func (cc *ClairClient) saveLayer(layer source.Layer) (err error) {
+	ctx,span := tracing.Start(cc.ctx,"fileserver.save",attribute.String("digest",layer.Digest))
+	defer func() { tracing.End(span,err) }()
+	logger := cc.logger().WithField(logging.FieldLayer,layer.Digest)
+
+	//download blob
+	r,err := cc.source.OpenLayer(ctx,layer)
 	if err != nil {
-		log.Errorf("get layer %s vuln err %v",preLayerDigest,err)
+		logger.Errorf("download layer err %v",err)
 		return err
 	}
 
-	endTime:= time.Now().Unix()
-	log.Infof("end get vulnerabilities,time %v",endTime)
+	// save to file server
+	fp,err := cc.fs.SaveFile(ctx,layer.Digest,progress.NewReader(r,progress.FromContext(cc.ctx)))
+	r.Close()
+	if err != nil {
+		logger.Errorf("save file err.%v",err)
+		return err
+	}
+	logger.Infof("save file to server ok,file path %s",fp)
+	return nil
+}
 
-	// add to sta
-	vulnName := make(map[string]int)
-	for _,v := range vulnerabilities {
-		s := v.Severity
-		n := v.ID
-		if _,ok := vulnName[n]; !ok {
-			vulnName[n] = 0
+// checkLayerDownloads records whether clair downloaded each layer from the file server,
+// a layer clair failed on without downloading it usually means clair can not reach us
+func (cc *ClairClient) checkLayerDownloads(status *clair.ScanStatus) {
+	if cc.fs == nil || cc.cfg.Registry.Direct {
+		return
+	}
+	for i := range status.Layers {
+		outcome := &status.Layers[i]
+		fetch := cc.fs.LayerFetch(outcome.Name)
+		downloaded := fetch.Downloads > 0
+		outcome.Downloaded = &downloaded
+		logger := cc.logger().WithFields(log.Fields{logging.FieldLayer: outcome.Name,logging.FieldLayerIndex: i})
+		switch {
+		case downloaded:
+			logger.Infof("clair downloaded layer %d times,%d bytes in %v",fetch.Downloads,fetch.Bytes,fetch.Duration)
+		case outcome.Error != "" && fetch.Requests == 0:
+			logger.Warnf("clair never requested layer,check clair can reach the file server at %s",cc.fs.BaseURL())
+		case outcome.Error != "":
+			logger.Warnf("clair requested layer %d times without a complete download,last status %d",fetch.Requests,fetch.LastStatus)
 		}
+	}
+}
+
+// directLayerRequests lets clair download the layers from the registry itself,
+// sending the registry Authorization header along
+func (cc *ClairClient) directLayerRequests(layers []source.Layer) ([]clair.LayerRequest,error) {
+	ds,ok := cc.source.(source.DirectSource)
+	if !ok {
+		return nil,fmt.Errorf("%s can not be scanned in direct mode,clair can only pull from a registry",cc.source.Reference())
+	}
+
+	requests := make([]clair.LayerRequest,0,len(layers))
+	for i,layer := range layers {
+		layer := layer
+		blobUrl := ds.LayerURL(layer)
+		cc.logger().WithFields(log.Fields{logging.FieldLayer: layer.Digest,logging.FieldLayerIndex: i}).Infof("layer registry path:%s",blobUrl)
+		requests = append(requests,clair.LayerRequest{
+			Name: layer.Digest,
+			Path: blobUrl,
+			// tokens may expire while earlier layers are scanned,get fresh ones right before each post
+			HeadersFunc: func(ctx context.Context) (map[string]string,error) {
+				return ds.LayerHeaders(ctx,layer)
+			},
+		})
+	}
+	return requests,nil
+}
 
-		if _,ok := cc.sta[s]; !ok {
-			cc.sta[s] = 1
-		} else {
-			cc.sta[s] = cc.sta[s] + 1
+// openSource opens the configured local image,default to scan image from registry
+func (cc *ClairClient) openSource() error {
+	if cc.source != nil {
+		return nil
+	}
+	img := cc.cfg.Image
+	var err error
+	switch {
+	case img.DockerArchive != "":
+		cc.source,err = source.NewDockerArchiveSource(img.DockerArchive,img.Ref)
+	case img.OCILayout != "":
+		cc.source,err = source.NewOCILayoutSource(img.OCILayout,img.Ref)
+	case img.Rootfs != "":
+		cc.source,err = source.NewRootfsSource(img.Rootfs)
+	default:
+		if cc.registryClient == nil {
+			if err = cc.NewRegistryClient(); err != nil {
+				return err
+			}
 		}
+		cc.source = source.NewRegistrySource(cc.registryClient,cc.fullRepoName,cc.cfg.Registry.Tag)
 	}
+	return err
+}
 
-	//write vuln detail to file
-	result,err := json.Marshal(vulnerabilities)
+// GetImageVuln fetches the vulnerabilities of an image that was scanned before. Only the top layer
+// of the manifest is asked from clair,its result covers the whole image. The layers are uploaded
+// with a full scan only when clair does not know the top layer.
+func (cc *ClairClient) GetImageVuln() (err error) {
+	ctx,span := tracing.Start(cc.ctx,"get")
+	defer func(parent context.Context) {
+		cc.ctx = parent
+		tracing.End(span,err)
+	}(cc.ctx)
+	cc.ctx = ctx
+
+	// the source resolves the tag once,a fallback scan posts the layers of the same digest
+	if err := cc.openSource(); err != nil {
+		return err
+	}
+	layers,err := cc.source.Layers(cc.ctx)
 	if err != nil {
-		log.Errorf("json marshal vul err %v",err)
-	} else {
-		err = ioutil.WriteFile("scan_result.txt", result, 0644)
-		if err != nil {
-			log.Errorf("write result err %v",err)
+		return err
+	}
+	if len(layers) == 0 {
+		return fmt.Errorf("image %s has no layers",cc.source.Reference())
+	}
+	if rs,ok := cc.source.(*source.RegistrySource); ok {
+		cc.imageDigest = rs.ImageDigest
+	}
+	for _,layer := range layers {
+		cc.layers = append(cc.layers,layer.Digest)
+	}
+	span.SetAttributes(attribute.String("image",cc.source.Reference()))
+	cc.ctx = logging.WithFields(cc.ctx,log.Fields{
+		logging.FieldImage: cc.source.Reference(),
+		logging.FieldDigest: cc.imageDigest.String(),
+	})
+
+	topLayer := layers[len(layers)-1].Digest
+	err = cc.GetLayerVuln(topLayer)
+	if !errors.Is(err,clair.ErrLayerNotFound) {
+		if err == nil {
+			metrics.CacheHit(clairResultCache)
 		}
+		return err
 	}
+	metrics.CacheMiss(clairResultCache)
 
-	//sort vuln name
-	keys := make([]string,0)
-	for k,_ := range vulnName {
-		keys = append(keys,k)
+	cc.logger().WithField(logging.FieldLayer,topLayer).Info("top layer unknown to clair,scan the image")
+	cc.layers = cc.layers[:0]
+	if err := cc.startFileServer(); err != nil {
+		return err
+	}
+	status,err := cc.PostScanTaskToClair()
+	if err != nil {
+		return err
 	}
-	sort.Strings(keys)
+	cc.logger().Infof("scan state %s,top layer %s",status.State,status.TopLayer)
+	return nil
+}
 
-	//write vuln name to file which will be used to diff with trivy
-	vulnStr := ""
-	for _,v := range keys {
-		vulnStr = vulnStr + v + "\n"
+// startFileServer starts the layer file server for a scan,not needed when clair pulls from the registry directly
+func (cc *ClairClient) startFileServer() error {
+	if cc.fs != nil || cc.cfg.Registry.Direct {
+		return nil
 	}
-	err = ioutil.WriteFile("scan_vuln_name.txt",([]byte)(vulnStr), 0644)
+	fs,err := newFileServer(cc.ctx,cc.cfg.FileServer,clairHost(cc.cfg.Clair))
 	if err != nil {
-		log.Errorf("write vuln name err %v",err)
+		return err
+	}
+	if err := fs.Run(cc.ctx); err != nil {
+		return err
 	}
+	cc.fs = fs
+	return nil
+}
 
-	log.Info("post layer to clair end")
+// stopFileServer stops the file server and removes the saved layers
+func (cc *ClairClient) stopFileServer() {
+	if cc.fs == nil {
+		return
+	}
+	cc.fs.StopFileServer()
+	cc.fs.Cleanup()
+}
 
+// GetLayerVuln fetches the vulnerabilities of a layer posted to clair before,
+// for the top layer of an image they cover the whole image
+func (cc *ClairClient) GetLayerVuln(layer string) error {
+	result,err := cc.client.GetLayerReport(cc.ctx,layer)
+	if err != nil {
+		return err
+	}
+	cc.saveResult(result)
 	return nil
 }
 
-func (cc *ClairClient) GetImageVuln() error {
+// saveResult counts the vulnerabilities by severity and writes them and the package inventory to the result files.
+// With output.groupByCVE a vulnerability found in several packages counts once.
+func (cc *ClairClient) saveResult(layerReport *clair.LayerReport) {
+	cc.packages = layerReport.Packages
+	vulnerabilities := layerReport.Vulnerabilities
+	if cc.cfg.Output.GroupByCVE {
+		vulnerabilities = report.GroupByID(vulnerabilities)
+	}
+	cc.vulnerabilities = vulnerabilities
 
-	return nil
+	// add to sta
+	for s,n := range report.CountBySeverity(vulnerabilities) {
+		cc.sta[s] = cc.sta[s] + n
+		metrics.Vulnerabilities.WithLabelValues(s).Add(float64(n))
+	}
+
+	//write all packages,also the ones without vulnerabilities
+	if cc.cfg.Output.PackagesFile != "" {
+		if err := writeJSONFile(cc.cfg.Output.PackagesFile,cc.packages); err != nil {
+			cc.logger().Errorf("write packages err %v",err)
+		}
+	}
+
+	//serve keeps results in memory only
+	if cc.cfg.Output.ResultFile == "" {
+		return
+	}
+
+	//write vuln detail to file
+	result,err := json.Marshal(vulnerabilities)
+	if err != nil {
+		cc.logger().Errorf("json marshal vul err %v",err)
+	} else {
+		err = ioutil.WriteFile(cc.cfg.Output.ResultFile, result, 0644)
+		if err != nil {
+			cc.logger().Errorf("write result err %v",err)
+		}
+	}
+
+	//write sorted vuln name to file which will be used to diff with trivy
+	err = ioutil.WriteFile(cc.cfg.Output.VulnNameFile,[]byte(report.Names(vulnerabilities)), 0644)
+	if err != nil {
+		cc.logger().Errorf("write vuln name err %v",err)
+	}
+}
+
+func writeJSONFile(path string,v interface{}) error {
+	data,err := json.MarshalIndent(v,"","  ")
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(path,data,0644)
 }
 
 func (cc *ClairClient) OutputVulnSta() error {
 	total := 0
 	for k,v := range cc.sta {
 		total = total + v
-		log.Infof("severity %s num %d",k,v)
+		cc.logger().Infof("severity %s num %d",k,v)
+	}
+	cc.logger().Infof("total vulnerabilities num %d",total)
+	return nil
+}
+
+// CheckPolicy fails when a vulnerability reaches the policy.failOnSeverity severity
+func (cc *ClairClient) CheckPolicy() error {
+	threshold := cc.cfg.Policy.FailOnSeverity
+	if threshold == "" {
+		return nil
+	}
+	for severity,num := range cc.sta {
+		if num > 0 && model.SeverityRank(severity) >= model.SeverityRank(threshold) {
+			return fmt.Errorf("found %s vulnerabilities,policy fails on %s or higher",severity,threshold)
+		}
 	}
-	log.Infof("total vulnerabilities num %d",total)
 	return nil
 }
@@ -0,0 +1,185 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/opencontainers/go-digest"
+	"github.com/wadeling/clair-client/pkg/clair"
+	"github.com/wadeling/clair-client/pkg/config"
+	"github.com/wadeling/clair-client/pkg/progress"
+	"github.com/wadeling/clair-client/pkg/registry-wrap"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// fakeRegistry serves one image and answers requests without a valid token with a bearer challenge.
+// A token is revoked once it checked a blob,so every blob check needs a new one.
+type fakeRegistry struct {
+	*httptest.Server
+	manifest []byte
+	digest digest.Digest
+	layers []digest.Digest
+
+	mu sync.Mutex
+	issued int
+	revoked map[string]bool
+}
+
+func newFakeRegistry(t *testing.T,layers ...string) *fakeRegistry {
+	r := &fakeRegistry{revoked: make(map[string]bool)}
+	type descriptor struct {
+		MediaType string `json:"mediaType"`
+		Size int64 `json:"size"`
+		Digest digest.Digest `json:"digest"`
+	}
+	m := struct {
+		SchemaVersion int `json:"schemaVersion"`
+		MediaType string `json:"mediaType"`
+		Config descriptor `json:"config"`
+		Layers []descriptor `json:"layers"`
+	}{
+		SchemaVersion: 2,
+		MediaType: "application/vnd.docker.distribution.manifest.v2+json",
+		Config: descriptor{"application/vnd.docker.container.image.v1+json",2,digest.FromString("{}")},
+	}
+	for _,l := range layers {
+		dg := digest.FromString(l)
+		r.layers = append(r.layers,dg)
+		m.Layers = append(m.Layers,descriptor{"application/vnd.docker.image.rootfs.diff.tar.gzip",int64(len(l)),dg})
+	}
+	var err error
+	if r.manifest,err = json.Marshal(m); err != nil {
+		t.Fatal(err)
+	}
+	r.digest = digest.FromBytes(r.manifest)
+	r.Server = httptest.NewServer(http.HandlerFunc(r.serve))
+	t.Cleanup(r.Close)
+	return r
+}
+
+func (r *fakeRegistry) serve(w http.ResponseWriter,req *http.Request) {
+	if req.URL.Path == "/token" {
+		r.mu.Lock()
+		r.issued++
+		token := fmt.Sprintf("token-%d",r.issued)
+		r.mu.Unlock()
+		json.NewEncoder(w).Encode(map[string]string{"token": token})
+		return
+	}
+	if !r.authorize(req) {
+		w.Header().Set("WWW-Authenticate",fmt.Sprintf(`Bearer realm="%s/token",service="registry"`,r.URL))
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+	switch {
+	case req.URL.Path == "/v2/":
+	case strings.HasPrefix(req.URL.Path,"/v2/library/alpine/manifests/"):
+		w.Header().Set("Content-Type","application/vnd.docker.distribution.manifest.v2+json")
+		w.Header().Set("Docker-Content-Digest",r.digest.String())
+		w.Write(r.manifest)
+	case strings.HasPrefix(req.URL.Path,"/v2/library/alpine/blobs/"):
+		w.WriteHeader(http.StatusOK)
+	default:
+		http.NotFound(w,req)
+	}
+}
+
+// latest is the Authorization header of the last issued token
+func (r *fakeRegistry) latest() string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return fmt.Sprintf("Bearer token-%d",r.issued)
+}
+
+func (r *fakeRegistry) authorize(req *http.Request) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	token := strings.TrimPrefix(req.Header.Get("Authorization"),"Bearer ")
+	if !strings.HasPrefix(token,"token-") || r.revoked[token] {
+		return false
+	}
+	if strings.Contains(req.URL.Path,"/blobs/") {
+		r.revoked[token] = true
+	}
+	return true
+}
+
+func TestDirectMode(t *testing.T) {
+	registry := newFakeRegistry(t,"l1","l2","l3")
+
+	var mu sync.Mutex
+	var posted []clair.NewerLayer
+	// whether each post carried the token issued last,i.e. the headers were fetched right before the post
+	var fresh []bool
+	clairSrv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter,r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		if r.Method == http.MethodGet {
+			json.NewEncoder(w).Encode(clair.NewerLayerEnvelope{Layer: clair.NewerLayer{Name: posted[len(posted)-1].Name}})
+			return
+		}
+		var envelope clair.NewerLayerEnvelope
+		if err := json.NewDecoder(r.Body).Decode(&envelope); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		posted = append(posted,envelope.Layer)
+		fresh = append(fresh,envelope.Layer.Headers["Authorization"] == registry.latest())
+		w.WriteHeader(http.StatusCreated)
+	}))
+	defer clairSrv.Close()
+
+	cfg := config.Default()
+	cfg.Registry.Direct = true
+	cfg.Registry.URL = registry.URL
+	cfg.Registry.Repository = "library"
+	cfg.Registry.Image = "alpine"
+	cfg.Registry.Tag = "3.12"
+	cfg.Clair.URL = clairSrv.URL
+	cfg.Output = config.OutputConfig{Progress: progress.ModeNone}
+
+	cc := newClairClient(cfg)
+	cc.fullRepoName = "library/alpine"
+	rc,err := registryWrap.NewRegistryClient(registryWrap.Credentials{},cc.fullRepoName,registry.URL,false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cc.registryClient = rc
+	if err := cc.NewClient(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	defer cc.cancel()
+	if err := cc.startFileServer(); err != nil {
+		t.Fatal(err)
+	}
+	if cc.fs != nil {
+		t.Error("direct mode started a file server")
+	}
+
+	status,err := cc.PostScanTaskToClair()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if status.State != clair.ScanComplete {
+		t.Fatalf("state = %s,want %s",status.State,clair.ScanComplete)
+	}
+	if len(posted) != len(registry.layers) {
+		t.Fatalf("clair got %d posts,want %d",len(posted),len(registry.layers))
+	}
+	seen := make(map[string]bool)
+	for i,l := range posted {
+		dg := registry.layers[i]
+		if want := registry.URL+"/v2/library/alpine/blobs/"+dg.String(); l.Path != want {
+			t.Errorf("layer %d path = %s,want %s",i,l.Path,want)
+		}
+		auth := l.Headers["Authorization"]
+		if !strings.HasPrefix(auth,"Bearer token-") || seen[auth] || !fresh[i] {
+			t.Errorf("layer %d Authorization = %q,want a new registry token",i,auth)
+		}
+		seen[auth] = true
+	}
+}
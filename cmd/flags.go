@@ -0,0 +1,120 @@
+package main
+
+import (
+	"flag"
+	"os"
+
+	"github.com/wadeling/clair-client/pkg/config"
+)
+
+const envConfigFile = config.EnvPrefix + "CONFIG"
+
+// the flags write straight into the config,so flags given on the command line
+// override the config file and environment when they are parsed again after loading those
+
+func bindRegistryFlags(fs *flag.FlagSet,cfg *config.Config) {
+	fs.StringVar(&cfg.Registry.Username,"user",cfg.Registry.Username,"registry user name.default from $"+config.EnvName("registry.username")+" or docker config.")
+	fs.StringVar(&cfg.Registry.Password,"password",cfg.Registry.Password,"registry user password.prefer $"+config.EnvName("registry.password")+" or docker config.")
+	fs.StringVar(&cfg.Registry.URL,"url",cfg.Registry.URL,"registry url.")
+	fs.StringVar(&cfg.Registry.Repository,"repo",cfg.Registry.Repository,"repository,like: library.")
+	fs.StringVar(&cfg.Registry.Image,"image",cfg.Registry.Image,"image name,like: busybox.")
+	fs.StringVar(&cfg.Registry.Tag,"tag",cfg.Registry.Tag,"tag name,like: latest.")
+	fs.BoolVar(&cfg.Registry.Insecure,"registry-insecure",cfg.Registry.Insecure,"retry without tls verification when the registry cert is invalid.")
+	fs.BoolVar(&cfg.Registry.Direct,"direct",cfg.Registry.Direct,"let clair pull layers from the registry with our registry token,no local file server.")
+}
+
+func bindImageFlags(fs *flag.FlagSet,cfg *config.Config) {
+	fs.StringVar(&cfg.Image.DockerArchive,"docker-archive",cfg.Image.DockerArchive,"scan a docker save tarball instead of a registry image.")
+	fs.StringVar(&cfg.Image.OCILayout,"oci-layout",cfg.Image.OCILayout,"scan an oci image layout directory or tarball instead of a registry image.")
+	fs.StringVar(&cfg.Image.Rootfs,"rootfs",cfg.Image.Rootfs,"scan an unpacked root filesystem directory as a single layer.")
+	fs.StringVar(&cfg.Image.Ref,"ref",cfg.Image.Ref,"image to scan in -docker-archive (repo:tag) or -oci-layout (ref name),default the first one.")
+}
+
+func bindClairFlags(fs *flag.FlagSet,cfg *config.Config) {
+	fs.StringVar(&cfg.Clair.IP,"clair-ip",cfg.Clair.IP,"Clair server ip.")
+	fs.IntVar(&cfg.Clair.Port,"clair-port",cfg.Clair.Port,"Clair server port.")
+	fs.StringVar(&cfg.Clair.URL,"clair-url",cfg.Clair.URL,"Clair api url,like https://clair:6060,overrides -clair-ip and -clair-port.")
+	fs.StringVar(&cfg.Clair.CA,"clair-ca",cfg.Clair.CA,"CA cert file to verify an https clair.")
+	fs.StringVar(&cfg.Clair.Cert,"clair-cert",cfg.Clair.Cert,"client cert file for mTLS to clair.")
+	fs.StringVar(&cfg.Clair.Key,"clair-key",cfg.Clair.Key,"client key file for mTLS to clair.")
+	fs.DurationVar(&cfg.Clair.Timeout,"clair-timeout",cfg.Clair.Timeout,"timeout of a single clair request.")
+	fs.StringVar(&cfg.Clair.Proxy,"clair-proxy",cfg.Clair.Proxy,"proxy url for clair requests,default $HTTP(S)_PROXY,\"direct\" for no proxy.")
+	fs.DurationVar(&cfg.Clair.ScanTimeout,"scan-timeout",cfg.Clair.ScanTimeout,"timeout of the whole scan.")
+	fs.StringVar(&cfg.Clair.Token,"clair-token",cfg.Clair.Token,"bearer token for a gateway in front of clair,prefer $"+config.EnvName("clair.token")+".")
+	fs.StringVar(&cfg.Clair.User,"clair-user",cfg.Clair.User,"basic auth user for a gateway in front of clair.")
+	fs.StringVar(&cfg.Clair.Password,"clair-password",cfg.Clair.Password,"basic auth password for a gateway in front of clair,prefer $"+config.EnvName("clair.password")+".")
+	fs.StringVar(&cfg.Clair.PSK,"clair-psk",cfg.Clair.PSK,"base64 pre-shared key to sign clair v4 style jwts,prefer $"+config.EnvName("clair.psk")+".")
+	fs.StringVar(&cfg.Clair.PSKIssuer,"clair-psk-issuer",cfg.Clair.PSKIssuer,"issuer claim of the jwts signed with -clair-psk.")
+}
+
+func bindFileServerFlags(fs *flag.FlagSet,cfg *config.Config) {
+	fs.IntVar(&cfg.FileServer.Port,"fs-port",cfg.FileServer.Port,"port of the layer file server,0 picks a free port.")
+	fs.StringVar(&cfg.FileServer.AdvertiseAddr,"advertise-addr",cfg.FileServer.AdvertiseAddr,"hostname or ip[:port] clair downloads layers from,ipv6 like [fd00::5]:5566.default the local address routing to clair.")
+	fs.StringVar(&cfg.FileServer.BindAddr,"bind-addr",cfg.FileServer.BindAddr,"ip the file server listens on,default the advertised ip,or all interfaces with -advertise-addr.")
+	fs.BoolVar(&cfg.FileServer.Stream,"fs-stream",cfg.FileServer.Stream,"stream layers from the registry or local image when clair downloads them,no layer is written to disk.")
+	fs.StringVar(&cfg.FileServer.RootDir,"fs-root",cfg.FileServer.RootDir,"parent of the layer directory of each run,relative to the temp dir.")
+	fs.DurationVar(&cfg.FileServer.URLTTL,"layer-url-ttl",cfg.FileServer.URLTTL,"validity of the signed layer urls sent to clair.")
+	fs.StringVar(&cfg.FileServer.TLSCert,"fs-tls-cert",cfg.FileServer.TLSCert,"serve layers over https with this cert,needs -fs-tls-key.")
+	fs.StringVar(&cfg.FileServer.TLSKey,"fs-tls-key",cfg.FileServer.TLSKey,"key of -fs-tls-cert.")
+	fs.BoolVar(&cfg.FileServer.TLSSelfSigned,"fs-tls-self-signed",cfg.FileServer.TLSSelfSigned,"serve layers over https with a generated self signed cert.")
+	fs.StringVar(&cfg.FileServer.TLSCAOut,"fs-tls-ca-out",cfg.FileServer.TLSCAOut,"where to write the ca cert of -fs-tls-self-signed,clair must trust it.an existing ca is reused.")
+	fs.StringVar(&cfg.FileServer.TLSCAKeyOut,"fs-tls-ca-key-out",cfg.FileServer.TLSCAKeyOut,"where to keep the key of the ca of -fs-tls-self-signed,empty for a new ca every run.")
+	fs.BoolVar(&cfg.FileServer.Metrics,"metrics",cfg.FileServer.Metrics,"serve prometheus metrics on /metrics of the file server,always on for the serve api.")
+}
+
+func bindOutputFlags(fs *flag.FlagSet,cfg *config.Config) {
+	fs.StringVar(&cfg.Output.ResultFile,"result-file",cfg.Output.ResultFile,"file of the vulnerability details.")
+	fs.StringVar(&cfg.Output.VulnNameFile,"vuln-name-file",cfg.Output.VulnNameFile,"file of the sorted vulnerability names.")
+	fs.StringVar(&cfg.Output.PackagesFile,"packages-file",cfg.Output.PackagesFile,"file of all packages of the image,vulnerable or not,empty to skip it.")
+	fs.BoolVar(&cfg.Output.GroupByCVE,"group-by-cve",cfg.Output.GroupByCVE,"one result per vulnerability id listing all affected packages,default one per id and package version.")
+}
+
+func bindProgressFlags(fs *flag.FlagSet,cfg *config.Config) {
+	fs.StringVar(&cfg.Output.Progress,"progress",cfg.Output.Progress,"scan progress: auto (a bar on a terminal,log lines otherwise),bar,log or none.")
+}
+
+func bindPolicyFlags(fs *flag.FlagSet,cfg *config.Config) {
+	fs.StringVar(&cfg.Policy.FailOnSeverity,"fail-on",cfg.Policy.FailOnSeverity,"exit with an error when a vulnerability of this or a higher severity is found.")
+}
+
+func bindTracingFlags(fs *flag.FlagSet,cfg *config.Config) {
+	fs.StringVar(&cfg.Tracing.Exporter,"trace-exporter",cfg.Tracing.Exporter,"export opentelemetry spans: none,stdout or otlp.")
+	fs.StringVar(&cfg.Tracing.Endpoint,"trace-endpoint",cfg.Tracing.Endpoint,"host:port of the OTLP/HTTP collector,default $OTEL_EXPORTER_OTLP_ENDPOINT.")
+	fs.BoolVar(&cfg.Tracing.Insecure,"trace-insecure",cfg.Tracing.Insecure,"send spans to the collector over plain http.")
+}
+
+func bindServeFlags(fs *flag.FlagSet,cfg *config.Config) {
+	fs.StringVar(&cfg.Serve.Listen,"listen",cfg.Serve.Listen,"address of the http api.")
+	fs.StringVar(&cfg.Serve.Token,"api-token",cfg.Serve.Token,"bearer token api clients must send,prefer $"+config.EnvName("serve.token")+".")
+}
+
+func bindLogFlags(fs *flag.FlagSet,cfg *config.Config) {
+	fs.StringVar(&cfg.Log.Format,"log-format",cfg.Log.Format,"log format: text or json.")
+	fs.StringVar(&cfg.Log.Level,"log-level",cfg.Log.Level,"log level: debug,info,warn or error.")
+}
+
+// loadConfig fills cfg from defaults,the -config file,the environment and the command line,in that order.
+// Every command has the log flags,the log section is always validated.
+func loadConfig(fs *flag.FlagSet,cfg *config.Config,args []string,sections ...config.Section) error {
+	configFile := fs.String("config",os.Getenv(envConfigFile),"yaml config file,see config.example.yaml.default $"+envConfigFile+".")
+	bindLogFlags(fs,cfg)
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if *configFile != "" {
+		if err := cfg.LoadFile(*configFile); err != nil {
+			return err
+		}
+	}
+	if err := cfg.ApplyEnv(); err != nil {
+		return err
+	}
+	// parse again so flags on the command line win
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if len(sections) > 0 {
+		sections = append(sections,config.SectionLog)
+	}
+	return cfg.Validate(sections...)
+}
@@ -0,0 +1,59 @@
+package main
+
+import (
+	"fmt"
+	"github.com/wadeling/clair-client/pkg/config"
+	"os"
+)
+
+func runGet(args []string) int {
+	cfg := config.Default()
+	flags := newFlagSet("get","Fetch the vulnerabilities of a registry image or a layer that was posted to clair before.\n"+
+		"Layers are only uploaded when clair does not know the top layer of the image.")
+	layer := flags.String("layer","","layer digest known to clair,instead of the registry image.")
+	bindRegistryFlags(flags,cfg)
+	bindClairFlags(flags,cfg)
+	bindFileServerFlags(flags,cfg)
+	bindOutputFlags(flags,cfg)
+	bindProgressFlags(flags,cfg)
+	bindPolicyFlags(flags,cfg)
+	bindTracingFlags(flags,cfg)
+	parseConfig(flags,cfg,args,config.SectionClair,config.SectionFileServer,config.SectionPolicy,config.SectionTracing,config.SectionOutput)
+	if *layer == "" {
+		if err := cfg.Validate(config.SectionImage); err != nil {
+			fmt.Fprintln(os.Stderr,err)
+			return exitUsage
+		}
+		if cfg.LocalImage() {
+			fmt.Fprintln(os.Stderr,"get only works for registry images,use -layer for local images")
+			return exitUsage
+		}
+	}
+
+	ctx,stop := signalContext()
+	defer stop()
+	defer setupTracing(ctx,cfg.Tracing)()
+
+	cc := newClairClient(cfg)
+	clairAuth,err := newClairAuthenticator(cfg.Clair)
+	if err != nil {
+		return exitCode(ctx,cc,usageError{fmt.Errorf("clair auth err %v",err)})
+	}
+	cc.clairAuth = clairAuth
+	if err := cc.NewClient(ctx); err != nil {
+		return exitCode(ctx,cc,usageError{fmt.Errorf("create clair client err %v",err)})
+	}
+	defer cc.cancel()
+	// only started when the image has to be scanned
+	defer cc.stopFileServer()
+
+	if *layer != "" {
+		err = cc.GetLayerVuln(*layer)
+	} else {
+		err = cc.GetImageVuln()
+	}
+	if err == nil {
+		cc.OutputVulnSta()
+	}
+	return exitCode(ctx,cc,err)
+}
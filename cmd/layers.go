@@ -0,0 +1,52 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	log "github.com/sirupsen/logrus"
+	"github.com/wadeling/clair-client/pkg/config"
+	"github.com/wadeling/clair-client/pkg/source"
+	"os"
+	"text/tabwriter"
+)
+
+func runLayers(args []string) int {
+	cfg := config.Default()
+	flags := newFlagSet("layers","List the layers of a registry or local image,bottom layer first.")
+	bindRegistryFlags(flags,cfg)
+	bindImageFlags(flags,cfg)
+	parseConfig(flags,cfg,args,config.SectionImage)
+
+	ctx,stop := signalContext()
+	defer stop()
+
+	cc := newClairClient(cfg)
+	if err := cc.openSource(); err != nil {
+		log.Errorf("open image err %v",err)
+		return exitError
+	}
+	defer cc.source.Close()
+
+	ctx,cancel := context.WithTimeout(ctx,cfg.Clair.ScanTimeout)
+	defer cancel()
+	layers,err := cc.source.Layers(ctx)
+	if err != nil {
+		log.Errorf("get layers err %v",err)
+		return exitError
+	}
+	if rs,ok := cc.source.(*source.RegistrySource); ok {
+		fmt.Printf("image %s\n",rs.ImageDigest)
+	}
+
+	tw := tabwriter.NewWriter(os.Stdout,0,4,2,' ',0)
+	fmt.Fprintln(tw,"INDEX\tDIGEST\tSIZE")
+	for i,l := range layers {
+		size := "-"
+		if l.Size >= 0 {
+			size = fmt.Sprintf("%d",l.Size)
+		}
+		fmt.Fprintf(tw,"%d\t%s\t%s\n",i,l.Digest,size)
+	}
+	tw.Flush()
+	return exitOK
+}
@@ -2,76 +2,165 @@ package main
 
 import (
 	"context"
+	"errors"
 	"flag"
-	log "github.com/sirupsen/logrus"
-	"github.com/wadeling/clair-client/pkg/fileserver"
-	"github.com/wadeling/clair-client/util"
+	"fmt"
 	"os"
-	"sync"
+	"os/signal"
+	"strings"
+	"syscall"
 	"time"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/wadeling/clair-client/pkg/clair"
+	"github.com/wadeling/clair-client/pkg/config"
+	"github.com/wadeling/clair-client/pkg/logging"
+	"github.com/wadeling/clair-client/pkg/tracing"
 )
 
+// process exit codes
+const (
+	exitOK = 0
+	// exitVulnerable vulnerabilities reached policy.failOnSeverity
+	exitVulnerable = 1
+	// exitUsage invalid flags or configuration
+	exitUsage = 2
+	// exitError the scan failed,there is no result
+	exitError = 3
+	// exitIncomplete the result misses layers or clair does not support the os of the image
+	exitIncomplete = 4
+	// exitInterrupted canceled by SIGINT or SIGTERM,like shells report a SIGINT
+	exitInterrupted = 130
+
+	tracingFlushTimeout = 5 * time.Second
+)
+
+// command is a subcommand of clair-client,run returns the exit code
+type command struct {
+	name    string
+	summary string
+	run     func(args []string) int
+}
+
+var commands = []command{
+	{"scan", "upload the image layers to clair and write the vulnerabilities", runScan},
+	{"get", "fetch the vulnerabilities of an image or layer posted to clair before", runGet},
+	{"serve", "run an http api scanning images on request", runServe},
+	{"report", "render the vulnerabilities of a previous scan in another format", runReport},
+	{"layers", "list the layers of an image", runLayers},
+}
+
 func main()  {
-	// Parse command-line arguments
-	flag.CommandLine = flag.NewFlagSet(os.Args[0], flag.ExitOnError)
-	flagClairIp:= flag.String("clair-ip", "", "Clair server ip.")
-	flagClairPort := flag.Int("clair-port", 0, "Clair server port.")
-	flagUser := flag.String("user", "", "registry user name.")
-	flagPassword := flag.String("password", "", "registry user password.")
-	flagRegistryUrl := flag.String("url", "", "registry url.")
-	flagRepository := flag.String("repo", "", "repository,like: library.")
-	flagImageName := flag.String("image", "", "image name,like: busybox.")
-	flagTagName := flag.String("tag", "", "tag name,like: latest.")
-	//flagAction := flag.String("action", "", "action: [post|get]")
-	flag.Parse()
-
-	cc := &ClairClient{
-		clairServerIP: *flagClairIp,
-		clairServerPort: *flagClairPort,
-		username: *flagUser,
-		password: *flagPassword,
-		registryUrl: *flagRegistryUrl,
-		repository: *flagRepository,
-		imageName: *flagImageName,
-		tagName: *flagTagName,
-		//action: *flagAction,
-		layers: make([]string,0),
-		sta:make(map[string]int),
+	args := os.Args[1:]
+	// without a command behave like before subcommands were added: scan
+	if len(args) == 0 || strings.HasPrefix(args[0],"-") {
+		os.Exit(runScan(args))
 	}
 
-	//create file server
-	ctx := context.Background()
-	fsIp,err := util.GetLocalIp()
-	if err != nil {
-		log.Error("get local ip err")
-		return
+	name := args[0]
+	if name == "help" && len(args) > 1 {
+		name,args = args[1],[]string{"-h"}
+	} else {
+		args = args[1:]
 	}
-	fsPort := 5566
-	fs,err := fileserver.NewFileServer(ctx,fileserver.FileServerRootDir,fsIp,fsIp,fsPort)
-	if err != nil {
-		log.Error("new file server err")
-		return
+	for _,c := range commands {
+		if c.name == name {
+			os.Exit(c.run(args))
+		}
+	}
+	if name != "help" && name != "-h" {
+		fmt.Fprintf(os.Stderr,"unknown command %s\n\n",name)
 	}
-	cc.fs = fs
+	usage()
+	os.Exit(exitUsage)
+}
 
-	var wg sync.WaitGroup
-	wg.Add(1)
-	go func() {
-		defer wg.Done()
-		fs.Run(ctx)
-	}()
+func usage() {
+	fmt.Fprintf(os.Stderr,"usage: %s <command> [flags]\n\ncommands:\n",os.Args[0])
+	for _,c := range commands {
+		fmt.Fprintf(os.Stderr,"  %-8s %s\n",c.name,c.summary)
+	}
+	fmt.Fprintf(os.Stderr,"\nrun '%s <command> -h' for the flags of a command\n",os.Args[0])
+}
 
-	time.Sleep(time.Duration(2)*time.Second)
+// newFlagSet creates the flag set of a command with its help text
+func newFlagSet(name,summary string) *flag.FlagSet {
+	fs := flag.NewFlagSet(name,flag.ExitOnError)
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(),"usage: %s %s [flags]\n\n%s\n\nflags:\n",os.Args[0],name,summary)
+		fs.PrintDefaults()
+	}
+	return fs
+}
 
-	//create clair client
-	cc.NewClient()
+// parseConfig parses the flags of a command into cfg,validates the sections the command needs
+// and sets up logging,it exits on invalid configuration
+func parseConfig(fs *flag.FlagSet,cfg *config.Config,args []string,sections ...config.Section) {
+	err := loadConfig(fs,cfg,args,sections...)
+	if err == nil {
+		err = logging.Setup(cfg.Log.Format,cfg.Log.Level)
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr,err)
+		os.Exit(exitUsage)
+	}
+}
+
+// signalContext is canceled on SIGINT or SIGTERM
+func signalContext() (context.Context,context.CancelFunc) {
+	return signal.NotifyContext(context.Background(),os.Interrupt,syscall.SIGTERM)
+}
+
+// setupTracing installs the configured span exporter,the returned func flushes the spans
+func setupTracing(ctx context.Context,cfg config.TracingConfig) func() {
+	shutdown,err := tracing.Setup(ctx,cfg.Exporter,cfg.Endpoint,cfg.Insecure)
+	if err != nil {
+		log.Errorf("setup tracing err %v,spans are not exported",err)
+		return func() {}
+	}
+	return func() {
+		ctx,cancel := context.WithTimeout(context.Background(),tracingFlushTimeout)
+		defer cancel()
+		if err := shutdown(ctx); err != nil {
+			log.Errorf("flush spans err %v",err)
+		}
+	}
+}
 
-	cc.PostScanTaskToClair()
+// usageError is an error of the flags or configuration,it exits with exitUsage
+type usageError struct {
+	err error
+}
 
-	cc.OutputVulnSta()
+func (e usageError) Error() string {
+	return e.err.Error()
+}
 
-	wg.Wait()
+// exitCode maps the outcome of a scan or get to the process exit code,
+// ctx is the signal context of the command
+func exitCode(ctx context.Context,cc *ClairClient,err error) int {
+	logger := cc.logger()
+	if ctx.Err() != nil {
+		logger.Warn("interrupted")
+		return exitInterrupted
+	}
+	var usage usageError
+	if errors.As(err,&usage) {
+		logger.Error(err)
+		return exitUsage
+	}
+	if err != nil {
+		logger.Errorf("scan err %v",err)
+		return exitError
+	}
+	if err := cc.CheckPolicy(); err != nil {
+		logger.Error(err)
+		return exitVulnerable
+	}
+	if cc.status != nil && cc.status.State != clair.ScanComplete {
+		logger.Warnf("scan is incomplete,state %s",cc.status.State)
+		return exitIncomplete
+	}
+	return exitOK
+}
 
-	time.Sleep(time.Duration(20)*time.Second)
-	log.Info("end")
-}
\ No newline at end of file
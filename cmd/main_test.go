@@ -0,0 +1,55 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/wadeling/clair-client/pkg/clair"
+	"github.com/wadeling/clair-client/pkg/config"
+	"testing"
+)
+
+func TestExitCode(t *testing.T) {
+	tests := []struct {
+		name string
+		state clair.ScanState
+		high int
+		err error
+		cancelled bool
+		want int
+	}{
+		{"complete","",0,nil,false,exitOK},
+		{"complete state",clair.ScanComplete,0,nil,false,exitOK},
+		{"vulnerable",clair.ScanComplete,1,nil,false,exitVulnerable},
+		{"vulnerable and partial",clair.ScanPartial,1,nil,false,exitVulnerable},
+		{"usage",clair.ScanComplete,0,usageError{errors.New("decode base64 psk err")},false,exitUsage},
+		{"wrapped usage","",0,fmt.Errorf("create client: %w",usageError{errors.New("invalid clair url")}),false,exitUsage},
+		{"error","",0,errors.New("connection refused"),false,exitError},
+		{"failed",clair.ScanFailed,0,errors.New("no layer could be posted"),false,exitError},
+		{"partial",clair.ScanPartial,0,nil,false,exitIncomplete},
+		{"unsupported os",clair.ScanUnsupportedOS,0,nil,false,exitIncomplete},
+		{"failed without error",clair.ScanFailed,0,nil,false,exitIncomplete},
+		{"interrupted","",0,context.Canceled,true,exitInterrupted},
+		{"interrupted wins over usage","",0,usageError{errors.New("bad flag")},true,exitInterrupted},
+		{"interrupted after a result",clair.ScanComplete,1,nil,true,exitInterrupted},
+	}
+	for _,tt := range tests {
+		t.Run(tt.name,func(t *testing.T) {
+			cfg := config.Default()
+			cfg.Policy.FailOnSeverity = "High"
+			cc := newClairClient(cfg)
+			cc.sta["High"] = tt.high
+			if tt.state != "" {
+				cc.status = &clair.ScanStatus{State: tt.state}
+			}
+			ctx,cancel := context.WithCancel(context.Background())
+			defer cancel()
+			if tt.cancelled {
+				cancel()
+			}
+			if got := exitCode(ctx,cc,tt.err); got != tt.want {
+				t.Errorf("exitCode() = %d,want %d",got,tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"fmt"
+	"github.com/wadeling/clair-client/pkg/config"
+	"github.com/wadeling/clair-client/pkg/report"
+	"io"
+	"os"
+	"strings"
+)
+
+func runReport(args []string) int {
+	cfg := config.Default()
+	flags := newFlagSet("report","Render the vulnerabilities or the packages stored by a previous scan or get in another format.")
+	format := flags.String("format",report.FormatTable,"output format: "+strings.Join(report.Formats,",")+",only "+strings.Join(report.PackageFormats,",")+" with -packages.")
+	out := flags.String("out","","write the report to this file,default stdout.")
+	packages := flags.Bool("packages",false,"render the package inventory of -packages-file instead of the vulnerabilities.")
+	bindOutputFlags(flags,cfg)
+	bindPolicyFlags(flags,cfg)
+	parseConfig(flags,cfg,args,config.SectionPolicy)
+
+	if *packages {
+		return runPackagesReport(cfg.Output.PackagesFile,*format,*out)
+	}
+
+	vulnerabilities,err := report.ReadResult(cfg.Output.ResultFile)
+	if err != nil {
+		fmt.Fprintln(os.Stderr,err)
+		return exitError
+	}
+	if cfg.Output.GroupByCVE {
+		vulnerabilities = report.GroupByID(vulnerabilities)
+	}
+
+	w,closeOut,err := reportOutput(*out)
+	if err != nil {
+		fmt.Fprintln(os.Stderr,err)
+		return exitError
+	}
+	defer closeOut()
+	if err := report.Render(w,*format,vulnerabilities); err != nil {
+		fmt.Fprintln(os.Stderr,err)
+		return exitUsage
+	}
+
+	cc := newClairClient(cfg)
+	cc.sta = report.CountBySeverity(vulnerabilities)
+	if err := cc.CheckPolicy(); err != nil {
+		fmt.Fprintln(os.Stderr,err)
+		return exitVulnerable
+	}
+	return exitOK
+}
+
+// runPackagesReport renders the package inventory,e.g. to find the images shipping a package
+func runPackagesReport(path,format,out string) int {
+	packages,err := report.ReadPackages(path)
+	if err != nil {
+		fmt.Fprintln(os.Stderr,err)
+		return exitError
+	}
+	w,closeOut,err := reportOutput(out)
+	if err != nil {
+		fmt.Fprintln(os.Stderr,err)
+		return exitError
+	}
+	defer closeOut()
+	if err := report.RenderPackages(w,format,packages); err != nil {
+		fmt.Fprintln(os.Stderr,err)
+		return exitUsage
+	}
+	return exitOK
+}
+
+// reportOutput opens the -out file,stdout if empty
+func reportOutput(out string) (io.Writer,func(),error) {
+	if out == "" {
+		return os.Stdout,func() {},nil
+	}
+	f,err := os.Create(out)
+	if err != nil {
+		return nil,nil,err
+	}
+	return f,func() { f.Close() },nil
+}
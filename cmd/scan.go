@@ -0,0 +1,159 @@
+package main
+
+import (
+	"context"
+	"encoding/base64"
+	"fmt"
+	log "github.com/sirupsen/logrus"
+	"github.com/wadeling/clair-client/pkg/clair"
+	"github.com/wadeling/clair-client/pkg/config"
+	"github.com/wadeling/clair-client/pkg/fileserver"
+	"github.com/wadeling/clair-client/pkg/metrics"
+	"github.com/wadeling/clair-client/util"
+	"net"
+	"net/url"
+)
+
+func runScan(args []string) int {
+	// defaults < config file < env < command-line arguments
+	cfg := config.Default()
+	flags := newFlagSet("scan","Upload the layers of a registry or local image to clair and write its vulnerabilities.\n"+
+		"exit code: 0 ok,1 policy.failOnSeverity reached,2 invalid flags or config,3 scan failed,4 incomplete result,130 interrupted.")
+	bindRegistryFlags(flags,cfg)
+	bindImageFlags(flags,cfg)
+	bindClairFlags(flags,cfg)
+	bindFileServerFlags(flags,cfg)
+	bindOutputFlags(flags,cfg)
+	bindProgressFlags(flags,cfg)
+	bindPolicyFlags(flags,cfg)
+	bindTracingFlags(flags,cfg)
+	parseConfig(flags,cfg,args)
+
+	// SIGINT and SIGTERM cancel the scan,the file server is still stopped and the layers removed
+	ctx,stop := signalContext()
+	defer stop()
+	defer setupTracing(ctx,cfg.Tracing)()
+
+	cc := newClairClient(cfg)
+	clairAuth,err := newClairAuthenticator(cfg.Clair)
+	if err != nil {
+		return exitCode(ctx,cc,usageError{fmt.Errorf("clair auth err %v",err)})
+	}
+	cc.clairAuth = clairAuth
+
+	if err := cc.openSource(); err != nil {
+		log.Errorf("open image err %v",err)
+		return exitError
+	}
+
+	//create clair client
+	if err := cc.NewClient(ctx); err != nil {
+		return exitCode(ctx,cc,usageError{fmt.Errorf("create clair client err %v",err)})
+	}
+	defer cc.cancel()
+
+	//create file server,not needed when clair pulls from the registry directly
+	if err := cc.startFileServer(); err != nil {
+		log.Errorf("start file server err %v",err)
+		return exitCode(ctx,cc,err)
+	}
+	defer cc.stopFileServer()
+
+	status,err := cc.PostScanTaskToClair()
+	if status != nil {
+		cc.logger().Infof("scan state %s,top layer %s",status.State,status.TopLayer)
+	}
+	cc.OutputVulnSta()
+
+	code := exitCode(ctx,cc,err)
+	cc.logger().Infof("end,exit code %d",code)
+	return code
+}
+
+func newFileServer(ctx context.Context,cfg config.FileServerConfig,clairHost string) (*fileserver.FileServer,error) {
+	externalIp,externalPort,err := fileServerAddr(cfg,clairHost)
+	if err != nil {
+		return nil,err
+	}
+	serverIp := util.TrimBrackets(cfg.BindAddr)
+	if serverIp == "" && cfg.AdvertiseAddr == "" {
+		// bind the address clair reaches,as before
+		serverIp = externalIp
+	}
+	fs,err := fileserver.NewFileServer(ctx,cfg.RootDir,externalIp,serverIp,cfg.Port)
+	if err != nil {
+		return nil,err
+	}
+	fs.ExternalPort = externalPort
+	fs.URLTTL = cfg.URLTTL
+	fs.Streaming = cfg.Stream
+	if cfg.Metrics {
+		fs.Handle("/metrics",metrics.Handler())
+	}
+	switch {
+	case cfg.TLSCert != "" || cfg.TLSKey != "":
+		if err := fs.EnableTLS(cfg.TLSCert,cfg.TLSKey); err != nil {
+			return nil,err
+		}
+	case cfg.TLSSelfSigned:
+		if err := fs.EnableSelfSignedTLS(cfg.TLSCAOut,cfg.TLSCAKeyOut); err != nil {
+			return nil,err
+		}
+	}
+	return fs,nil
+}
+
+// fileServerAddr picks the host and port (0 for the listen port) clair downloads layers from:
+// the advertised address,else the local address routing to clair,else the first local address
+func fileServerAddr(cfg config.FileServerConfig,clairHost string) (string,int,error) {
+	if cfg.AdvertiseAddr != "" {
+		return util.ParseAdvertiseAddr(cfg.AdvertiseAddr)
+	}
+	if clairHost != "" {
+		ip,err := util.GetRouteIp(clairHost)
+		switch {
+		case err != nil:
+			log.Warnf("find route to clair %s err %v,use the first local ip",clairHost,err)
+		case net.ParseIP(ip).IsLoopback():
+			// a clair container can not reach our loopback address
+			log.Warnf("clair %s is on this host,use the first local ip,set -advertise-addr if clair can not reach it",clairHost)
+		default:
+			log.Infof("file server address %s routes to clair %s",ip,clairHost)
+			return ip,0,nil
+		}
+	}
+	ip,err := util.GetLocalIp()
+	if err != nil {
+		return "",0,fmt.Errorf("get local ip err %v",err)
+	}
+	return ip,0,nil
+}
+
+// clairHost returns the host of the clair url
+func clairHost(cfg config.ClairConfig) string {
+	if cfg.URL == "" {
+		return cfg.IP
+	}
+	u,err := url.Parse(cfg.URL)
+	if err != nil {
+		return ""
+	}
+	return u.Hostname()
+}
+
+// newClairAuthenticator picks the clair authenticator from the config,nil if none is set
+func newClairAuthenticator(cfg config.ClairConfig) (clair.Authenticator,error) {
+	switch {
+	case cfg.PSK != "":
+		key,err := base64.StdEncoding.DecodeString(cfg.PSK)
+		if err != nil {
+			return nil,fmt.Errorf("decode base64 psk err %v",err)
+		}
+		return clair.PSK(key,cfg.PSKIssuer),nil
+	case cfg.Token != "":
+		return clair.BearerToken(cfg.Token),nil
+	case cfg.User != "":
+		return clair.BasicAuth(cfg.User,cfg.Password),nil
+	}
+	return nil,nil
+}
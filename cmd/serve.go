@@ -0,0 +1,252 @@
+package main
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	log "github.com/sirupsen/logrus"
+	"github.com/wadeling/clair-client/pkg/clair"
+	"github.com/wadeling/clair-client/pkg/config"
+	"github.com/wadeling/clair-client/pkg/metrics"
+	"github.com/wadeling/clair-client/pkg/model"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// running scans get this long to finish on shutdown
+const apiShutdownTimeout = 30 * time.Second
+
+// scanRequest is the body of POST /v1/scan,empty fields default to the registry config
+type scanRequest struct {
+	URL        string `json:"url"`
+	Repository string `json:"repository"`
+	Image      string `json:"image"`
+	Tag        string `json:"tag"`
+}
+
+type scanResponse struct {
+	// ScanID tags the log lines of the scan
+	ScanID          string                    `json:"scanId,omitempty"`
+	Image           string                    `json:"image"`
+	Digest          string                    `json:"digest,omitempty"`
+	Status          *clair.ScanStatus         `json:"status,omitempty"`
+	Vulnerabilities []model.VulnerabilityInfo `json:"vulnerabilities"`
+	Packages        []model.Package           `json:"packages,omitempty"`
+}
+
+type server struct {
+	cfg *config.Config
+	// base holds the clair client shared by all scans,every scan runs its own file server
+	base *ClairClient
+	// busy is set when the file server port is fixed,only one scan can listen on it at a time
+	busy chan struct{}
+}
+
+func runServe(args []string) int {
+	cfg := config.Default()
+	flags := newFlagSet("serve","Run an http api scanning registry images on request:\n"+
+		"  POST /v1/scan {\"url\",\"repository\",\"image\",\"tag\"}  scan an image\n"+
+		"  GET  /v1/layers/<digest>/vulnerabilities      vulnerabilities of a layer known to clair\n"+
+		"  GET  /metrics                                 prometheus metrics\n"+
+		"  GET  /healthz\n"+
+		"The /v1 requests need the header \"Authorization: Bearer <serve.token>\".")
+	bindServeFlags(flags,cfg)
+	bindRegistryFlags(flags,cfg)
+	bindClairFlags(flags,cfg)
+	bindFileServerFlags(flags,cfg)
+	bindTracingFlags(flags,cfg)
+	parseConfig(flags,cfg,args,config.SectionClair,config.SectionFileServer,config.SectionTracing,config.SectionServe)
+
+	ctx,stop := signalContext()
+	defer stop()
+	defer setupTracing(ctx,cfg.Tracing)()
+
+	cc := newClairClient(cfg)
+	clairAuth,err := newClairAuthenticator(cfg.Clair)
+	if err != nil {
+		log.Errorf("clair auth err %v",err)
+		return exitUsage
+	}
+	cc.clairAuth = clairAuth
+	if err := cc.NewClient(ctx); err != nil {
+		log.Errorf("create clair client err %v",err)
+		return exitUsage
+	}
+	defer cc.cancel()
+
+	s := &server{cfg: cfg,base: cc}
+	if cfg.FileServer.Port != 0 && !cfg.Registry.Direct {
+		s.busy = make(chan struct{},1)
+	}
+	mux := http.NewServeMux()
+	mux.Handle("/v1/scan",s.authenticate(http.HandlerFunc(s.handleScan)))
+	mux.Handle("/v1/layers/",s.authenticate(http.HandlerFunc(s.handleLayer)))
+	mux.Handle("/metrics",metrics.Handler())
+	mux.HandleFunc("/healthz",func(w http.ResponseWriter,r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})
+	api := &http.Server{Addr: cfg.Serve.Listen,Handler: mux}
+
+	errCh := make(chan error,1)
+	go func() {
+		log.Infof("serve api on %s",cfg.Serve.Listen)
+		errCh <- api.ListenAndServe()
+	}()
+	select {
+	case err := <-errCh:
+		log.Errorf("serve api err %v",err)
+		return exitError
+	case <-ctx.Done():
+	}
+
+	log.Info("shutting down")
+	shutdownCtx,cancel := context.WithTimeout(context.Background(),apiShutdownTimeout)
+	defer cancel()
+	if err := api.Shutdown(shutdownCtx); err != nil {
+		log.Errorf("shutdown api err %v",err)
+	}
+	return exitOK
+}
+
+// authenticate rejects requests without the bearer token of serve.token
+func (s *server) authenticate(next http.Handler) http.Handler {
+	want := []byte("Bearer "+s.cfg.Serve.Token)
+	return http.HandlerFunc(func(w http.ResponseWriter,r *http.Request) {
+		if subtle.ConstantTimeCompare([]byte(r.Header.Get("Authorization")),want) != 1 {
+			w.Header().Set("WWW-Authenticate",`Bearer realm="clair-client"`)
+			http.Error(w,http.StatusText(http.StatusUnauthorized),http.StatusUnauthorized)
+			return
+		}
+		next.ServeHTTP(w,r)
+	})
+}
+
+// newScan returns a client for one request sharing the clair client,
+// the scan starts its own file server
+func (s *server) newScan(ctx context.Context,registry config.RegistryConfig) *ClairClient {
+	cfg := *s.cfg
+	cfg.Registry = registry
+	cfg.Image = config.ImageConfig{}
+	cfg.Output = config.OutputConfig{}
+	// the api serves /metrics
+	cfg.FileServer.Metrics = false
+	cc := newClairClient(&cfg)
+	cc.clairAuth = s.base.clairAuth
+	cc.client = s.base.client
+	cc.newScanContext(ctx)
+	return cc
+}
+
+// sameRegistry reports whether two registry urls are on the same host and port
+func sameRegistry(a,b string) bool {
+	host := func(u string) string {
+		if !strings.Contains(u,"://") {
+			u = "https://"+u
+		}
+		parsed,err := url.Parse(u)
+		if err != nil {
+			return ""
+		}
+		return strings.ToLower(parsed.Host)
+	}
+	ha := host(a)
+	return ha != "" && ha == host(b)
+}
+
+func (s *server) handleScan(w http.ResponseWriter,r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w,"method not allowed",http.StatusMethodNotAllowed)
+		return
+	}
+	var req scanRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w,fmt.Sprintf("invalid request: %v",err),http.StatusBadRequest)
+		return
+	}
+	registry := s.cfg.Registry
+	// the configured credentials are only sent to the configured registry,
+	// other registries get the credentials stored for their host in the docker config
+	hostCredentials := req.URL != "" && !sameRegistry(req.URL,s.cfg.Registry.URL)
+	if hostCredentials {
+		registry.Username,registry.Password = "",""
+	}
+	for _,f := range []struct{ dst *string; v string }{
+		{&registry.URL,req.URL},{&registry.Repository,req.Repository},{&registry.Image,req.Image},{&registry.Tag,req.Tag},
+	} {
+		if f.v != "" {
+			*f.dst = f.v
+		}
+	}
+	if registry.URL == "" || registry.Repository == "" || registry.Image == "" || registry.Tag == "" {
+		http.Error(w,"url,repository,image and tag are required",http.StatusBadRequest)
+		return
+	}
+
+	if s.busy != nil {
+		select {
+		case s.busy <- struct{}{}:
+			defer func() { <-s.busy }()
+		default:
+			w.Header().Set("Retry-After","30")
+			http.Error(w,"a scan is running on the fixed file server port,retry later",http.StatusServiceUnavailable)
+			return
+		}
+	}
+	cc := s.newScan(r.Context(),registry)
+	cc.hostCredentials = hostCredentials
+	defer cc.cancel()
+	if err := cc.startFileServer(); err != nil {
+		cc.logger().Errorf("start file server err %v",err)
+		writeJSON(w,http.StatusInternalServerError,map[string]string{"error": err.Error(),"scanId": cc.scanID})
+		return
+	}
+	// clair has fetched the layers once the scan returns
+	defer cc.stopFileServer()
+
+	status,err := cc.PostScanTaskToClair()
+	if err != nil {
+		cc.logger().Errorf("scan %s/%s:%s err %v",registry.Repository,registry.Image,registry.Tag,err)
+		writeJSON(w,http.StatusBadGateway,map[string]interface{}{"error": err.Error(),"status": status,"scanId": cc.scanID})
+		return
+	}
+	writeJSON(w,http.StatusOK,scanResponse{
+		ScanID: cc.scanID,
+		Image: cc.source.Reference(),
+		Digest: cc.imageDigest.String(),
+		Status: status,
+		Vulnerabilities: cc.vulnerabilities,
+		Packages: cc.packages,
+	})
+}
+
+func (s *server) handleLayer(w http.ResponseWriter,r *http.Request) {
+	name := strings.TrimSuffix(strings.TrimPrefix(r.URL.Path,"/v1/layers/"),"/vulnerabilities")
+	if r.Method != http.MethodGet || name == "" || strings.Contains(name,"/") {
+		http.NotFound(w,r)
+		return
+	}
+
+	cc := s.newScan(r.Context(),s.cfg.Registry)
+	defer cc.cancel()
+	if err := cc.GetLayerVuln(name); err != nil {
+		code := http.StatusBadGateway
+		if errors.Is(err,clair.ErrLayerNotFound) {
+			code = http.StatusNotFound
+		}
+		writeJSON(w,code,map[string]string{"error": err.Error()})
+		return
+	}
+	writeJSON(w,http.StatusOK,scanResponse{Image: name,Vulnerabilities: cc.vulnerabilities,Packages: cc.packages})
+}
+
+func writeJSON(w http.ResponseWriter,code int,v interface{}) {
+	w.Header().Set("Content-Type","application/json")
+	w.WriteHeader(code)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		log.Errorf("write response err %v",err)
+	}
+}
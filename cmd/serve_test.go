@@ -0,0 +1,72 @@
+package main
+
+import (
+	"github.com/wadeling/clair-client/pkg/config"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestAuthenticate(t *testing.T) {
+	cfg := config.Default()
+	cfg.Serve.Token = "s3cret"
+	s := &server{cfg: cfg}
+	handler := s.authenticate(http.HandlerFunc(func(w http.ResponseWriter,r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	tests := []struct {
+		name string
+		auth string
+		want int
+	}{
+		{"missing","",http.StatusUnauthorized},
+		{"wrong","Bearer wrong",http.StatusUnauthorized},
+		{"token prefix","Bearer s3c",http.StatusUnauthorized},
+		{"basic","Basic czNjcmV0",http.StatusUnauthorized},
+		{"no scheme","s3cret",http.StatusUnauthorized},
+		{"correct","Bearer s3cret",http.StatusNoContent},
+	}
+	for _,tt := range tests {
+		t.Run(tt.name,func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost,"/scan",nil)
+			if tt.auth != "" {
+				req.Header.Set("Authorization",tt.auth)
+			}
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w,req)
+			if w.Code != tt.want {
+				t.Errorf("status = %d,want %d",w.Code,tt.want)
+			}
+			if tt.want == http.StatusUnauthorized && w.Header().Get("WWW-Authenticate") == "" {
+				t.Error("401 without WWW-Authenticate")
+			}
+		})
+	}
+}
+
+func TestSameRegistry(t *testing.T) {
+	tests := []struct {
+		a,b string
+		want bool
+	}{
+		{"harbor.example.com","harbor.example.com",true},
+		{"Harbor.Example.com","harbor.example.COM",true},
+		{"https://harbor.example.com","harbor.example.com",true},
+		{"http://harbor.example.com","https://harbor.example.com/",true},
+		{"https://harbor.example.com/v2/","harbor.example.com",true},
+		{"harbor.example.com:5000","harbor.example.com:5000",true},
+		{"harbor.example.com:5000","harbor.example.com",false},
+		{"https://harbor.example.com:5000","https://harbor.example.com:5001",false},
+		{"harbor.example.com","registry.example.com",false},
+		{"harbor.example.com.evil.io","harbor.example.com",false},
+		{"","harbor.example.com",false},
+		{"","",false},
+		{"http://[::1","http://[::1",false},
+		{"harbor.example.com","https://harbor.example.com:%zz",false},
+	}
+	for _,tt := range tests {
+		if got := sameRegistry(tt.a,tt.b); got != tt.want {
+			t.Errorf("sameRegistry(%q,%q) = %v,want %v",tt.a,tt.b,got,tt.want)
+		}
+	}
+}
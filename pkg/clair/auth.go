@@ -0,0 +1,96 @@
+package clair
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"time"
+)
+
+const (
+	// pskTokenLifetime keeps signed tokens short lived,a new one is signed for every request
+	pskTokenLifetime = 5 * time.Minute
+	// allow for clock skew between us and the gateway
+	pskClockSkew = 30 * time.Second
+)
+
+// Authenticator adds credentials to every request sent to clair,
+// e.g. for an auth proxy in front of clair
+type Authenticator interface {
+	Authenticate(req *http.Request) error
+}
+
+// AuthenticatorFunc adapts a func to an Authenticator
+type AuthenticatorFunc func(req *http.Request) error
+
+func (f AuthenticatorFunc) Authenticate(req *http.Request) error {
+	return f(req)
+}
+
+// BearerToken sends a static token in the Authorization header
+func BearerToken(token string) Authenticator {
+	return AuthenticatorFunc(func(req *http.Request) error {
+		req.Header.Set("Authorization", "Bearer "+token)
+		return nil
+	})
+}
+
+func BasicAuth(username, password string) Authenticator {
+	return AuthenticatorFunc(func(req *http.Request) error {
+		req.SetBasicAuth(username, password)
+		return nil
+	})
+}
+
+// PSK signs a short lived HS256 JWT with a pre-shared key for every request,
+// like clair v4 services authenticate to each other. issuer must be one of the
+// issuers clair (or the gateway) accepts for that key.
+func PSK(key []byte, issuer string) Authenticator {
+	return &pskAuthenticator{key: key, issuer: issuer, now: time.Now}
+}
+
+type pskAuthenticator struct {
+	key    []byte
+	issuer string
+	now    func() time.Time
+}
+
+type jwtClaims struct {
+	Issuer    string `json:"iss"`
+	IssuedAt  int64  `json:"iat"`
+	NotBefore int64  `json:"nbf"`
+	Expiry    int64  `json:"exp"`
+}
+
+func (a *pskAuthenticator) Authenticate(req *http.Request) error {
+	now := a.now()
+	token, err := signHS256(a.key, jwtClaims{
+		Issuer:    a.issuer,
+		IssuedAt:  now.Unix(),
+		NotBefore: now.Add(-pskClockSkew).Unix(),
+		Expiry:    now.Add(pskTokenLifetime).Unix(),
+	})
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+token)
+	return nil
+}
+
+func signHS256(key []byte, claims interface{}) (string, error) {
+	header, err := json.Marshal(map[string]string{"alg": "HS256", "typ": "JWT"})
+	if err != nil {
+		return "", err
+	}
+	payload, err := json.Marshal(claims)
+	if err != nil {
+		return "", err
+	}
+	enc := base64.RawURLEncoding
+	signingInput := enc.EncodeToString(header) + "." + enc.EncodeToString(payload)
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(signingInput))
+	return signingInput + "." + enc.EncodeToString(mac.Sum(nil)), nil
+}
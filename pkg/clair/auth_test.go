@@ -0,0 +1,105 @@
+package clair
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestAuthenticators(t *testing.T) {
+	tests := []struct {
+		name string
+		auth Authenticator
+		want string
+	}{
+		{"none", nil, ""},
+		{"bearer", BearerToken("t0k3n"), "Bearer t0k3n"},
+		// base64 of "clair:s3cret"
+		{"basic", BasicAuth("clair", "s3cret"), "Basic Y2xhaXI6czNjcmV0"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			opts := []Option{WithBaseURL("http://clair:6060")}
+			if tt.auth != nil {
+				opts = append(opts, WithAuthenticator(tt.auth))
+			}
+			c, err := NewClient(opts...)
+			if err != nil {
+				t.Fatal(err)
+			}
+			req, err := c.newRequest(context.Background(), http.MethodGet, "/v1/layers/l1", nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := req.Header.Get("Authorization"); got != tt.want {
+				t.Errorf("Authorization = %q,want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPSK(t *testing.T) {
+	key := []byte("0123456789abcdef")
+	now := time.Unix(1600000000, 0)
+	auth := PSK(key, "clairctl").(*pskAuthenticator)
+	auth.now = func() time.Time { return now }
+
+	c, err := NewClient(WithBaseURL("http://clair:6060"), WithAuthenticator(auth))
+	if err != nil {
+		t.Fatal(err)
+	}
+	req, err := c.newRequest(context.Background(), http.MethodGet, "/v1/layers/l1", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	token := strings.TrimPrefix(req.Header.Get("Authorization"), "Bearer ")
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		t.Fatalf("token %q has %d parts,want 3", token, len(parts))
+	}
+	enc := base64.RawURLEncoding
+
+	var header map[string]string
+	data, err := enc.DecodeString(parts[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := json.Unmarshal(data, &header); err != nil {
+		t.Fatal(err)
+	}
+	if header["alg"] != "HS256" || header["typ"] != "JWT" {
+		t.Errorf("header = %v,want alg HS256 typ JWT", header)
+	}
+
+	var claims jwtClaims
+	if data, err = enc.DecodeString(parts[1]); err != nil {
+		t.Fatal(err)
+	}
+	if err := json.Unmarshal(data, &claims); err != nil {
+		t.Fatal(err)
+	}
+	want := jwtClaims{
+		Issuer:    "clairctl",
+		IssuedAt:  now.Unix(),
+		NotBefore: now.Unix() - 30,
+		Expiry:    now.Unix() + 300,
+	}
+	if claims != want {
+		t.Errorf("claims = %+v,want %+v", claims, want)
+	}
+
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(parts[0] + "." + parts[1]))
+	if sig := enc.EncodeToString(mac.Sum(nil)); parts[2] != sig {
+		t.Errorf("signature = %s,want %s", parts[2], sig)
+	}
+	if strings.ContainsAny(token, "=+/") {
+		t.Errorf("token %q is not unpadded base64url", token)
+	}
+}
@@ -30,6 +30,8 @@ type NewerLayer struct {
 	ParentName    string
 	Format        string
 	NamespaceName string
+	// Headers are sent by clair when it downloads Path,e.g. the registry Authorization
+	Headers       map[string]string `json:"Headers,omitempty"`
 	Features      []NewerLayerFeature
 }
 
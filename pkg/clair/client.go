@@ -5,31 +5,55 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
-	log "github.com/sirupsen/logrus"
 	"github.com/wadeling/clair-client/pkg/model"
+	"github.com/wadeling/clair-client/pkg/retry"
+	"github.com/wadeling/clair-client/pkg/tracing"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/propagation"
+	"io"
 	"io/ioutil"
 	"net/http"
+	"net/url"
 	"strings"
+	"time"
 )
 
 const (
-	postLayerURI        = "http://%s:%d/v1/layers"
-	getLayerFeaturesURI = "http://%s:%d/v1/layers/%s?vulnerabilities"
+	layersPath = "/v1/layers"
 )
 
+// Client talks to the clair v1 api,create it with NewClient
 type Client struct {
-	Ctx context.Context
-	ClairAddr string
-	ClairPort int
+	baseURL    *url.URL
+	httpClient *http.Client
+	timeout    time.Duration // of a single request attempt
+	auth       Authenticator // nil sends no credentials
+
+	// RetryPolicy of every clair request,nil means retry.DefaultPolicy
+	RetryPolicy *retry.Policy
+	// Breaker stops calling clair after consecutive failures,nil disables it
+	Breaker *retry.Breaker
 }
 
 func (c *Client) ScheduleLayerScanInClair(ctx context.Context, path, layerName, parentLayerName string) error {
+	return c.ScheduleLayerScanInClairWithHeaders(ctx, path, nil, layerName, parentLayerName)
+}
+
+// ScheduleLayerScanInClairWithHeaders posts a layer clair downloads from path sending headers,
+// so clair can pull the blob from an authenticated registry itself
+func (c *Client) ScheduleLayerScanInClairWithHeaders(ctx context.Context, path string, headers map[string]string, layerName, parentLayerName string) (err error) {
+	ctx, span := tracing.Start(ctx, "clair.post_layer",
+		attribute.String("layer", layerName), attribute.String("parent", parentLayerName))
+	defer func() { tracing.End(span, err) }()
+
 	payload := NewerLayerEnvelope{
 		Layer: NewerLayer{
 			Name:       layerName,
 			Path:       path,
 			ParentName: parentLayerName,
 			Format:     "Docker",
+			Headers:    headers,
 		},
 	}
 	jsonPayload, err := json.Marshal(payload)
@@ -37,70 +61,57 @@ func (c *Client) ScheduleLayerScanInClair(ctx context.Context, path, layerName,
 		return fmt.Errorf("json marshal err %v",err)
 	}
 
-	reqPath := fmt.Sprintf(postLayerURI, c.ClairAddr, c.ClairPort)
-	request, err := http.NewRequest("POST", reqPath, bytes.NewBuffer(jsonPayload))
+	return c.withRetry(ctx, func(ctx context.Context) error {
+		return c.scheduleLayer(ctx, layerName, jsonPayload)
+	})
+}
+
+func (c *Client) scheduleLayer(ctx context.Context, layerName string, jsonPayload []byte) error {
+	request, err := c.newRequest(ctx, "POST", layersPath, bytes.NewBuffer(jsonPayload))
 	if err != nil {
 		return fmt.Errorf("new request err %v",err)
 	}
 	request.Header.Set("Content-Type", "application/json")
 
-	client := &http.Client{}
-	response, err := client.Do(request.WithContext(ctx))
+	response, err := c.httpClient.Do(request)
 	if err != nil {
-		return fmt.Errorf("http client request err %v",err)
+		return newTransportError("post layer", layerName, err)
 	}
 	defer response.Body.Close()
 
 	if response.StatusCode != http.StatusCreated {
 		body, err := ioutil.ReadAll(response.Body)
 		if err != nil {
-			return fmt.Errorf("read clair response err.%d,%v",response.StatusCode,err)
+			return &Error{Op: "post layer", Layer: layerName, StatusCode: response.StatusCode, Err: err}
 		}
-
-		if response.StatusCode >= 300 {
-			clairResponseError := &NewerLayerEnvelope{}
-			err := json.Unmarshal(body, clairResponseError)
-			if err != nil {
-				return fmt.Errorf("json unmarshal clair response err %v",err)
-			}
-
-			if response.StatusCode == http.StatusBadRequest {
-				if strings.Contains(clairResponseError.Error.Message, "parent layer is unknown") {
-					return fmt.Errorf("clair response not found layer err %s",clairResponseError.Error.Message)
-				}
-			}
-
-			if response.StatusCode == http.StatusUnprocessableEntity {
-				// Possible cause: "worker: OS and/or package manager are not supported"
-				return fmt.Errorf("clair response err:%d %s",response.StatusCode,clairResponseError.Error.Message)
-			}
-		}
-
-		return fmt.Errorf("expected clair return 201,but get %d,body %v",response.StatusCode,body)
+		return newResponseError("post layer", layerName, response.StatusCode, body)
 	}
 
 	return nil
 }
 
+// GetTransformedLayerScanResultFromClair returns the namespace and the vulnerabilities of a layer,
+// one per vulnerability id and package version in the order clair returns them
 func (c *Client) GetTransformedLayerScanResultFromClair(ctx context.Context, digest string) (string, []model.VulnerabilityInfo, error) {
-	var vulnerabilities = make([]model.VulnerabilityInfo, 0)
-	var vulnerabilitiesMap = make(map[string]model.VulnerabilityInfo)
-	rawVulnerabilities, err := c.FetchLayerVulnerabilitiesFromClair(ctx, digest)
+	report, err := c.GetLayerReport(ctx, digest)
 	if err != nil {
-		return "", []model.VulnerabilityInfo{}, fmt.Errorf("Could not fetch vulnerabilities of %s: %w", digest, err)
+		return "", []model.VulnerabilityInfo{}, err
 	}
-	log.Infof("Fetched vulnerabilities of %s", digest)
+	return report.Namespace, report.Vulnerabilities, nil
+}
+
+// transformVulnerabilities converts the vulnerabilities of the layer features
+func transformVulnerabilities(rawVulnerabilities NewerLayer) []model.VulnerabilityInfo {
+	var vulnerabilities = make([]model.VulnerabilityInfo, 0)
+	var seen = make(map[model.VulnerabilityKey]bool)
 
 	for _, feature := range rawVulnerabilities.Features {
 		if len(feature.Vulnerabilities) > 0 {
 			for _, vulnerability := range feature.Vulnerabilities {
 
+				// metadata is optional,without it the vulnerability has no cvss scores
 				var meta metadataT
 				json.Unmarshal([]byte(vulnerability.Metadata), &meta)
-				if err != nil {
-					log.Errorf("unmarshal raw metadata %+v,digest %s",vulnerability.Metadata,digest)
-					return "", []model.VulnerabilityInfo{}, fmt.Errorf("Failed to unmarshal metadata of %s: %w", digest, err)
-				}
 
 				newVuln := model.VulnerabilityInfo{
 					FeatureName:    feature.Name,
@@ -132,37 +143,48 @@ func (c *Client) GetTransformedLayerScanResultFromClair(ctx context.Context, dig
 					})
 				}
 
-				vulnerabilitiesMap[newVuln.ID] = newVuln
+				if seen[newVuln.Key()] {
+					continue
+				}
+				seen[newVuln.Key()] = true
+				vulnerabilities = append(vulnerabilities, newVuln)
 			}
 		}
 	}
-	for _, vulnerability := range vulnerabilitiesMap {
-		vulnerabilities = append(vulnerabilities, vulnerability)
-	}
-	return rawVulnerabilities.NamespaceName, vulnerabilities, nil
+	return vulnerabilities
 }
 
 func (c *Client) FetchLayerVulnerabilitiesFromClair(ctx context.Context, layerID string) (NewerLayer, error) {
+	ctx, span := tracing.Start(ctx, "clair.get_layer", attribute.String("layer", layerID))
+	var layer NewerLayer
+	err := c.withRetry(ctx, func(ctx context.Context) error {
+		var err error
+		layer, err = c.fetchLayer(ctx, layerID)
+		return err
+	})
+	span.SetAttributes(attribute.Int("features", len(layer.Features)))
+	tracing.End(span, err)
+	return layer, err
+}
 
-	reqPath := fmt.Sprintf(getLayerFeaturesURI, c.ClairAddr, c.ClairPort, layerID)
-	request, err := http.NewRequest("GET", reqPath, nil)
+func (c *Client) fetchLayer(ctx context.Context, layerID string) (NewerLayer, error) {
+	request, err := c.newRequest(ctx, "GET", layerPath(layerID)+"?vulnerabilities", nil)
 	if err != nil {
 		return NewerLayer{}, fmt.Errorf("Failed to prepare request to Clair: %w", err)
 	}
 
-	client := &http.Client{}
-	response, err := client.Do(request.WithContext(ctx))
+	response, err := c.httpClient.Do(request)
 	if err != nil {
-		return NewerLayer{},fmt.Errorf("Failed to send request to Clair: %w", err)
+		return NewerLayer{}, newTransportError("get layer", layerID, err)
 	}
 	defer response.Body.Close()
 
 	if response.StatusCode != http.StatusOK {
 		body, err := ioutil.ReadAll(response.Body)
 		if err != nil {
-			return NewerLayer{},fmt.Errorf("Failed to read response from Clair: %w", err)
+			return NewerLayer{}, &Error{Op: "get layer", Layer: layerID, StatusCode: response.StatusCode, Err: err}
 		}
-		return NewerLayer{}, fmt.Errorf("Expected Clair to return status 200, got: %v, body: %v", response.StatusCode, string(body))
+		return NewerLayer{}, newResponseError("get layer", layerID, response.StatusCode, body)
 	}
 
 	var apiResponse NewerLayerEnvelope
@@ -170,8 +192,40 @@ func (c *Client) FetchLayerVulnerabilitiesFromClair(ctx context.Context, layerID
 		return NewerLayer{},fmt.Errorf("Failed to decode reponse from Clair: %w", err)
 	}
 	if apiResponse.Error != nil {
-		return NewerLayer{}, fmt.Errorf("Clair responded with error: %v", apiResponse.Error.Message)
+		return NewerLayer{}, &Error{Op: "get layer", Layer: layerID, StatusCode: response.StatusCode, Message: apiResponse.Error.Message}
 	}
 
 	return apiResponse.Layer, nil
 }
+
+// newRequest creates an authenticated request to path (with optional query) below the clair base url
+func (c *Client) newRequest(ctx context.Context, method, path string, body io.Reader) (*http.Request, error) {
+	u := *c.baseURL
+	if i := strings.IndexByte(path, '?'); i >= 0 {
+		u.RawQuery = path[i+1:]
+		path = path[:i]
+	}
+	// path is escaped already,see layerPath. keep it in RawPath so the escaping is not doubled
+	u.RawPath = c.baseURL.EscapedPath() + path
+	unescaped, err := url.PathUnescape(u.RawPath)
+	if err != nil {
+		return nil, err
+	}
+	u.Path = unescaped
+	req, err := http.NewRequestWithContext(ctx, method, u.String(), body)
+	if err != nil {
+		return nil, err
+	}
+	// lets a gateway in front of clair join our traces
+	otel.GetTextMapPropagator().Inject(ctx, propagation.HeaderCarrier(req.Header))
+	if c.auth != nil {
+		if err := c.auth.Authenticate(req); err != nil {
+			return nil, fmt.Errorf("authenticate clair request err %v", err)
+		}
+	}
+	return req, nil
+}
+
+func layerPath(layerName string) string {
+	return layersPath + "/" + url.PathEscape(layerName)
+}
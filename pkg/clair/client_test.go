@@ -0,0 +1,115 @@
+package clair
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	"github.com/wadeling/clair-client/pkg/model"
+)
+
+func TestNewRequestEscaping(t *testing.T) {
+	tests := []struct {
+		name    string
+		baseURL string
+		layer   string
+		query   string
+		want    string
+	}{
+		{"digest", "http://clair:6060", "sha256:abc", "", "/v1/layers/sha256:abc"},
+		{"slash in name", "http://clair:6060", "library/alpine", "", "/v1/layers/library%2Falpine"},
+		{"space in name", "http://clair:6060", "a b", "", "/v1/layers/a%20b"},
+		{"base path", "http://gw/clair/", "sha256:abc", "", "/clair/v1/layers/sha256:abc"},
+		{"escaped base path", "http://gw/my%20clair", "a/b", "", "/my%20clair/v1/layers/a%2Fb"},
+		{"query", "http://clair:6060", "a/b", "?vulnerabilities", "/v1/layers/a%2Fb?vulnerabilities"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, err := NewClient(WithBaseURL(tt.baseURL))
+			if err != nil {
+				t.Fatal(err)
+			}
+			req, err := c.newRequest(context.Background(), "GET", layerPath(tt.layer)+tt.query, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := req.URL.RequestURI(); got != tt.want {
+				t.Errorf("RequestURI() = %s,want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestLayerNameRoundTrip(t *testing.T) {
+	var got string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = r.URL.Path
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer srv.Close()
+
+	c, err := NewClient(WithBaseURL(srv.URL))
+	if err != nil {
+		t.Fatal(err)
+	}
+	code, err := c.getLayerStatus(context.Background(), "library/alpine:3.12")
+	if err != nil || code != http.StatusOK {
+		t.Fatalf("getLayerStatus() = %d,%v", code, err)
+	}
+	if want := "/v1/layers/library/alpine:3.12"; got != want {
+		t.Errorf("server got path %s,want %s", got, want)
+	}
+}
+
+func TestTransformVulnerabilities(t *testing.T) {
+	cve := func(name string) NewerLayerFeaturesVulnerability {
+		return NewerLayerFeaturesVulnerability{Name: name, Severity: "High"}
+	}
+	key := func(id, name, version string) model.VulnerabilityKey {
+		return model.VulnerabilityKey{ID: id, FeatureName: name, FeatureVersion: version}
+	}
+	tests := []struct {
+		name     string
+		features []NewerLayerFeature
+		want     []model.VulnerabilityKey
+	}{
+		{"no features", nil, []model.VulnerabilityKey{}},
+		{"feature without vulnerabilities", []NewerLayerFeature{{Name: "musl", Version: "1.1"}}, []model.VulnerabilityKey{}},
+		{"same cve in two packages",
+			[]NewerLayerFeature{
+				{Name: "openssl", Version: "1.1", Vulnerabilities: []NewerLayerFeaturesVulnerability{cve("CVE-1")}},
+				{Name: "libssl1.1", Version: "1.1", Vulnerabilities: []NewerLayerFeaturesVulnerability{cve("CVE-1")}},
+			},
+			[]model.VulnerabilityKey{key("CVE-1", "openssl", "1.1"), key("CVE-1", "libssl1.1", "1.1")}},
+		{"same cve twice in one package",
+			[]NewerLayerFeature{
+				{Name: "openssl", Version: "1.1", Vulnerabilities: []NewerLayerFeaturesVulnerability{cve("CVE-1"), cve("CVE-2"), cve("CVE-1")}},
+			},
+			[]model.VulnerabilityKey{key("CVE-1", "openssl", "1.1"), key("CVE-2", "openssl", "1.1")}},
+		{"package listed twice",
+			[]NewerLayerFeature{
+				{Name: "openssl", Version: "1.1", Vulnerabilities: []NewerLayerFeaturesVulnerability{cve("CVE-1")}},
+				{Name: "openssl", Version: "1.1", Vulnerabilities: []NewerLayerFeaturesVulnerability{cve("CVE-1")}},
+			},
+			[]model.VulnerabilityKey{key("CVE-1", "openssl", "1.1")}},
+		{"two versions of a package",
+			[]NewerLayerFeature{
+				{Name: "openssl", Version: "1.0", Vulnerabilities: []NewerLayerFeaturesVulnerability{cve("CVE-1")}},
+				{Name: "openssl", Version: "1.1", Vulnerabilities: []NewerLayerFeaturesVulnerability{cve("CVE-1")}},
+			},
+			[]model.VulnerabilityKey{key("CVE-1", "openssl", "1.0"), key("CVE-1", "openssl", "1.1")}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := make([]model.VulnerabilityKey, 0)
+			for _, v := range transformVulnerabilities(NewerLayer{Features: tt.features}) {
+				got = append(got, v.Key())
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("transformVulnerabilities() keys = %v,want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,93 @@
+package clair
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+var (
+	// ErrParentUnknown clair does not know the parent of the posted layer
+	ErrParentUnknown = errors.New("clair: parent layer is unknown")
+	// ErrUnsupportedOS clair can not detect the OS and/or package manager of the layer
+	ErrUnsupportedOS = errors.New("clair: OS and/or package manager are not supported")
+	// ErrLayerNotFound the layer was never posted to clair
+	ErrLayerNotFound = errors.New("clair: layer not found")
+	// ErrClairUnavailable clair could not be reached or answered with a server error
+	ErrClairUnavailable = errors.New("clair: unavailable")
+)
+
+// Error is a failed clair request. Kind is one of the Err* values above or nil,
+// use errors.Is(err, clair.ErrUnsupportedOS) etc. to check it.
+type Error struct {
+	// Op is the operation,like "post layer"
+	Op string
+	// Layer the request was about
+	Layer string
+	// StatusCode of clair's response,0 if there was no response
+	StatusCode int
+	// Message is the error message returned by clair
+	Message string
+	Kind    error
+	// Err is the underlying error,e.g. from the http client
+	Err error
+}
+
+func (e *Error) Error() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "clair %s", e.Op)
+	if e.Layer != "" {
+		fmt.Fprintf(&b, " %s", e.Layer)
+	}
+	if e.StatusCode != 0 {
+		fmt.Fprintf(&b, ": status %d", e.StatusCode)
+	}
+	if e.Message != "" {
+		fmt.Fprintf(&b, ": %s", e.Message)
+	}
+	if e.Err != nil {
+		fmt.Fprintf(&b, ": %v", e.Err)
+	}
+	return b.String()
+}
+
+func (e *Error) Is(target error) bool {
+	return e.Kind != nil && e.Kind == target
+}
+
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+// newTransportError wraps an error of the http client,including per request timeouts
+func newTransportError(op, layer string, err error) *Error {
+	return &Error{Op: op, Layer: layer, Err: err, Kind: ErrClairUnavailable}
+}
+
+// newResponseError classifies a non successful clair response by status code and message
+func newResponseError(op, layer string, statusCode int, body []byte) *Error {
+	e := &Error{Op: op, Layer: layer, StatusCode: statusCode}
+
+	envelope := &NewerLayerEnvelope{}
+	if err := json.Unmarshal(body, envelope); err == nil && envelope.Error != nil {
+		e.Message = envelope.Error.Message
+	} else {
+		e.Message = strings.TrimSpace(string(body))
+	}
+
+	switch {
+	case statusCode == http.StatusBadRequest && strings.Contains(e.Message, "parent layer is unknown"):
+		e.Kind = ErrParentUnknown
+	case statusCode == http.StatusUnprocessableEntity && strings.Contains(e.Message, "not supported"):
+		// "worker: OS and/or package manager are not supported",
+		// clair also answers 422 when it can not extract the layer,those stay plain errors
+		e.Kind = ErrUnsupportedOS
+	case statusCode == http.StatusNotFound:
+		e.Kind = ErrLayerNotFound
+	case statusCode >= http.StatusInternalServerError:
+		e.Kind = ErrClairUnavailable
+	}
+	return e
+}
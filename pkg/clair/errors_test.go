@@ -0,0 +1,84 @@
+package clair
+
+import (
+	"errors"
+	"net/http"
+	"testing"
+)
+
+func TestNewResponseError(t *testing.T) {
+	tests := []struct {
+		name        string
+		statusCode  int
+		body        string
+		wantKind    error
+		wantMessage string
+	}{
+		{
+			name:        "parent unknown",
+			statusCode:  http.StatusBadRequest,
+			body:        `{"Error":{"Message":"could not find layer: parent layer is unknown"}}`,
+			wantKind:    ErrParentUnknown,
+			wantMessage: "could not find layer: parent layer is unknown",
+		},
+		{
+			name:        "other bad request",
+			statusCode:  http.StatusBadRequest,
+			body:        `{"Error":{"Message":"could not decode layer"}}`,
+			wantMessage: "could not decode layer",
+		},
+		{
+			name:        "unsupported os",
+			statusCode:  http.StatusUnprocessableEntity,
+			body:        `{"Error":{"Message":"worker: OS and/or package manager are not supported"}}`,
+			wantKind:    ErrUnsupportedOS,
+			wantMessage: "worker: OS and/or package manager are not supported",
+		},
+		{
+			name:        "could not extract",
+			statusCode:  http.StatusUnprocessableEntity,
+			body:        `{"Error":{"Message":"utils: could not extract the archive"}}`,
+			wantMessage: "utils: could not extract the archive",
+		},
+		{
+			name:        "extracted file too big",
+			statusCode:  http.StatusUnprocessableEntity,
+			body:        `{"Error":{"Message":"utils: could not extract one or more files from the archive: file too big"}}`,
+			wantMessage: "utils: could not extract one or more files from the archive: file too big",
+		},
+		{
+			name:        "not found",
+			statusCode:  http.StatusNotFound,
+			body:        `{"Error":{"Message":"the resource cannot be found"}}`,
+			wantKind:    ErrLayerNotFound,
+			wantMessage: "the resource cannot be found",
+		},
+		{
+			name:        "server error with plain body",
+			statusCode:  http.StatusBadGateway,
+			body:        "bad gateway\n",
+			wantKind:    ErrClairUnavailable,
+			wantMessage: "bad gateway",
+		},
+		{
+			name:        "unauthorized",
+			statusCode:  http.StatusUnauthorized,
+			body:        "",
+			wantMessage: "",
+		},
+	}
+	kinds := []error{ErrParentUnknown, ErrUnsupportedOS, ErrLayerNotFound, ErrClairUnavailable}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := newResponseError("post layer", "sha256:abc", tt.statusCode, []byte(tt.body))
+			if err.Message != tt.wantMessage {
+				t.Errorf("Message = %q,want %q", err.Message, tt.wantMessage)
+			}
+			for _, kind := range kinds {
+				if got, want := errors.Is(err, kind), kind == tt.wantKind; got != want {
+					t.Errorf("errors.Is(err, %v) = %v,want %v", kind, got, want)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,58 @@
+package clair
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/wadeling/clair-client/pkg/logging"
+	"github.com/wadeling/clair-client/pkg/model"
+)
+
+// LayerReport is what clair found in a layer and the layers below it
+type LayerReport struct {
+	Namespace       string
+	Vulnerabilities []model.VulnerabilityInfo
+	// Packages are all features,vulnerable or not
+	Packages []model.Package
+}
+
+// GetLayerReport fetches the vulnerabilities and the package inventory of a layer with a single request
+func (c *Client) GetLayerReport(ctx context.Context, digest string) (*LayerReport, error) {
+	layer, err := c.FetchLayerVulnerabilitiesFromClair(ctx, digest)
+	if err != nil {
+		return nil, fmt.Errorf("Could not fetch vulnerabilities of %s: %w", digest, err)
+	}
+	logging.FromContext(ctx).WithField(logging.FieldLayer, digest).Info("Fetched vulnerabilities")
+
+	return &LayerReport{
+		Namespace:       layer.NamespaceName,
+		Vulnerabilities: transformVulnerabilities(layer),
+		Packages:        Inventory(layer),
+	}, nil
+}
+
+// GetLayerInventory returns every package clair found in a layer and the layers below it,
+// also those without vulnerabilities
+func (c *Client) GetLayerInventory(ctx context.Context, digest string) ([]model.Package, error) {
+	report, err := c.GetLayerReport(ctx, digest)
+	if err != nil {
+		return nil, err
+	}
+	return report.Packages, nil
+}
+
+// Inventory lists the features of a layer fetched from clair in the order clair returns them
+func Inventory(layer NewerLayer) []model.Package {
+	packages := make([]model.Package, 0, len(layer.Features))
+	for _, feature := range layer.Features {
+		packages = append(packages, model.Package{
+			Name:            feature.Name,
+			Version:         feature.Version,
+			VersionFormat:   feature.VersionFormat,
+			Namespace:       feature.NamespaceName,
+			AddedBy:         feature.AddedBy,
+			Vulnerabilities: len(feature.Vulnerabilities),
+		})
+	}
+	return packages
+}
@@ -0,0 +1,95 @@
+package clair
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"sync/atomic"
+	"testing"
+
+	"github.com/wadeling/clair-client/pkg/model"
+	"github.com/wadeling/clair-client/pkg/retry"
+)
+
+func TestInventory(t *testing.T) {
+	tests := []struct {
+		name  string
+		layer NewerLayer
+		want  []model.Package
+	}{
+		{"no features", NewerLayer{}, []model.Package{}},
+		{"features keep clair's order",
+			NewerLayer{Features: []NewerLayerFeature{
+				{Name: "musl", Version: "1.1.24", VersionFormat: "dpkg", NamespaceName: "alpine:v3.12", AddedBy: "sha256:a"},
+				{Name: "busybox", Version: "1.31.1", VersionFormat: "dpkg", NamespaceName: "alpine:v3.12", AddedBy: "sha256:b"},
+			}},
+			[]model.Package{
+				{Name: "musl", Version: "1.1.24", VersionFormat: "dpkg", Namespace: "alpine:v3.12", AddedBy: "sha256:a"},
+				{Name: "busybox", Version: "1.31.1", VersionFormat: "dpkg", Namespace: "alpine:v3.12", AddedBy: "sha256:b"},
+			}},
+		{"vulnerabilities are counted",
+			NewerLayer{Features: []NewerLayerFeature{
+				{Name: "openssl", Version: "1.1", Vulnerabilities: []NewerLayerFeaturesVulnerability{{Name: "CVE-1"}, {Name: "CVE-2"}}},
+				{Name: "zlib", Version: "1.2"},
+			}},
+			[]model.Package{
+				{Name: "openssl", Version: "1.1", Vulnerabilities: 2},
+				{Name: "zlib", Version: "1.2"},
+			}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Inventory(tt.layer); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Inventory() = %+v,want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestGetLayerReport(t *testing.T) {
+	layer := NewerLayer{
+		Name:          "sha256:top",
+		NamespaceName: "alpine:v3.12",
+		Features: []NewerLayerFeature{
+			{Name: "openssl", Version: "1.1", Vulnerabilities: []NewerLayerFeaturesVulnerability{{Name: "CVE-1", Severity: "High"}}},
+			{Name: "zlib", Version: "1.2"},
+		},
+	}
+	var requests int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&requests, 1)
+		if r.URL.Path != "/v1/layers/sha256:top" || r.URL.RawQuery != "vulnerabilities" {
+			http.NotFound(w, r)
+			return
+		}
+		json.NewEncoder(w).Encode(NewerLayerEnvelope{Layer: layer})
+	}))
+	defer srv.Close()
+
+	c, err := NewClient(WithBaseURL(srv.URL), WithRetryPolicy(retry.NoRetry))
+	if err != nil {
+		t.Fatal(err)
+	}
+	report, err := c.GetLayerReport(context.Background(), "sha256:top")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n := atomic.LoadInt32(&requests); n != 1 {
+		t.Errorf("got %d requests,want 1", n)
+	}
+	if report.Namespace != "alpine:v3.12" {
+		t.Errorf("namespace = %s,want alpine:v3.12", report.Namespace)
+	}
+	if len(report.Vulnerabilities) != 1 || report.Vulnerabilities[0].ID != "CVE-1" {
+		t.Errorf("vulnerabilities = %+v,want CVE-1", report.Vulnerabilities)
+	}
+	if len(report.Packages) != 2 || report.Packages[0].Vulnerabilities != 1 || report.Packages[1].Vulnerabilities != 0 {
+		t.Errorf("packages = %+v,want openssl with 1 and zlib with 0 vulnerabilities", report.Packages)
+	}
+
+	if _, err := c.GetLayerInventory(context.Background(), "sha256:unknown"); err == nil {
+		t.Error("GetLayerInventory of an unknown layer: want error")
+	}
+}
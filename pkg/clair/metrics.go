@@ -0,0 +1,40 @@
+package clair
+
+import (
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/wadeling/clair-client/pkg/metrics"
+)
+
+// instrumentedTransport observes the latency and status code of every clair request by endpoint
+type instrumentedTransport struct {
+	next     http.RoundTripper
+	basePath string // path prefix of the clair url
+}
+
+func (t *instrumentedTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	start := time.Now()
+	resp, err := t.next.RoundTrip(req)
+	code := 0
+	if err == nil {
+		code = resp.StatusCode
+	}
+	metrics.ObserveClairRequest(t.endpoint(req), code, time.Since(start))
+	return resp, err
+}
+
+func (t *instrumentedTransport) endpoint(req *http.Request) string {
+	path := strings.TrimPrefix(req.URL.Path, t.basePath)
+	switch {
+	case req.Method == http.MethodPost && path == layersPath:
+		return "post_layer"
+	case req.Method == http.MethodGet && strings.HasPrefix(path, layersPath+"/"):
+		if _, ok := req.URL.Query()["vulnerabilities"]; ok {
+			return "get_layer_vulnerabilities"
+		}
+		return "get_layer"
+	}
+	return "other"
+}
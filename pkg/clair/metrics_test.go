@@ -0,0 +1,38 @@
+package clair
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestEndpoint(t *testing.T) {
+	tests := []struct {
+		name     string
+		basePath string
+		method   string
+		target   string
+		want     string
+	}{
+		{"post layer", "", http.MethodPost, "/v1/layers", "post_layer"},
+		{"get layer", "", http.MethodGet, "/v1/layers/sha256:0123abcd", "get_layer"},
+		{"get other layer", "", http.MethodGet, "/v1/layers/sha256:fedc9876", "get_layer"},
+		{"layer vulnerabilities", "", http.MethodGet, "/v1/layers/sha256:0123abcd?vulnerabilities", "get_layer_vulnerabilities"},
+		{"layer name with slashes", "", http.MethodGet, "/v1/layers/library%2Falpine:3.12?features&vulnerabilities", "get_layer_vulnerabilities"},
+		{"below a base path", "/clair", http.MethodGet, "/clair/v1/layers/sha256:0123abcd", "get_layer"},
+		{"post below a base path", "/clair", http.MethodPost, "/clair/v1/layers", "post_layer"},
+		{"registry blob", "", http.MethodGet, "/v2/library/alpine/blobs/sha256:0123abcd", "other"},
+		{"registry manifest", "", http.MethodGet, "/v2/library/alpine/manifests/3.12", "other"},
+		{"delete layer", "", http.MethodDelete, "/v1/layers/sha256:0123abcd", "other"},
+		{"layers list", "", http.MethodGet, "/v1/layers", "other"},
+		{"namespaces", "", http.MethodGet, "/v1/namespaces", "other"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tr := &instrumentedTransport{basePath: tt.basePath}
+			if got := tr.endpoint(httptest.NewRequest(tt.method, tt.target, nil)); got != tt.want {
+				t.Errorf("endpoint(%s %s) = %s,want %s", tt.method, tt.target, got, tt.want)
+			}
+		})
+	}
+}
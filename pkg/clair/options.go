@@ -0,0 +1,226 @@
+package clair
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/wadeling/clair-client/pkg/retry"
+)
+
+const (
+	DefaultRequestTimeout = 5 * time.Minute
+
+	defaultMaxIdleConns = 10
+)
+
+type clientOptions struct {
+	baseURL            string
+	caFile             string
+	certFile           string
+	keyFile            string
+	insecureSkipVerify bool
+	timeout            time.Duration
+	proxy              string
+	transport          http.RoundTripper
+	retryPolicy        *retry.Policy
+	breaker            *retry.Breaker
+	authenticator      Authenticator
+}
+
+// Option configures a Client created by NewClient
+type Option func(o *clientOptions) error
+
+// WithBaseURL sets the clair api url,like http://clair:6060 or https://clair.example.com/prefix
+func WithBaseURL(baseURL string) Option {
+	return func(o *clientOptions) error {
+		o.baseURL = baseURL
+		return nil
+	}
+}
+
+// WithAddr sets an http clair api url from host and port
+func WithAddr(host string, port int) Option {
+	return func(o *clientOptions) error {
+		o.baseURL = "http://" + net.JoinHostPort(host, strconv.Itoa(port))
+		return nil
+	}
+}
+
+// WithCACert trusts the PEM encoded CA certificates in caFile in addition to the system pool
+func WithCACert(caFile string) Option {
+	return func(o *clientOptions) error {
+		o.caFile = caFile
+		return nil
+	}
+}
+
+// WithClientCert authenticates to clair with a client certificate (mTLS)
+func WithClientCert(certFile, keyFile string) Option {
+	return func(o *clientOptions) error {
+		if (certFile == "") != (keyFile == "") {
+			return fmt.Errorf("client cert and key must be set together")
+		}
+		o.certFile = certFile
+		o.keyFile = keyFile
+		return nil
+	}
+}
+
+func WithInsecureSkipVerify(skip bool) Option {
+	return func(o *clientOptions) error {
+		o.insecureSkipVerify = skip
+		return nil
+	}
+}
+
+// WithTimeout limits every single request attempt,0 disables the timeout
+func WithTimeout(timeout time.Duration) Option {
+	return func(o *clientOptions) error {
+		o.timeout = timeout
+		return nil
+	}
+}
+
+// WithProxy sends requests through proxyURL. Empty uses the HTTP(S)_PROXY environment,
+// "direct" disables proxies.
+func WithProxy(proxyURL string) Option {
+	return func(o *clientOptions) error {
+		o.proxy = proxyURL
+		return nil
+	}
+}
+
+// WithTransport replaces the pooled transport,TLS and proxy options are ignored then
+func WithTransport(transport http.RoundTripper) Option {
+	return func(o *clientOptions) error {
+		o.transport = transport
+		return nil
+	}
+}
+
+func WithRetryPolicy(policy retry.Policy) Option {
+	return func(o *clientOptions) error {
+		o.retryPolicy = &policy
+		return nil
+	}
+}
+
+func WithBreaker(breaker *retry.Breaker) Option {
+	return func(o *clientOptions) error {
+		o.breaker = breaker
+		return nil
+	}
+}
+
+// WithAuthenticator authenticates every request,see BearerToken,BasicAuth and PSK
+func WithAuthenticator(authenticator Authenticator) Option {
+	return func(o *clientOptions) error {
+		o.authenticator = authenticator
+		return nil
+	}
+}
+
+// NewClient creates a clair client. The base url is required,see WithBaseURL and WithAddr.
+// The client keeps a pooled transport,create it once and reuse it for all requests.
+func NewClient(opts ...Option) (*Client, error) {
+	o := &clientOptions{timeout: DefaultRequestTimeout}
+	for _, opt := range opts {
+		if err := opt(o); err != nil {
+			return nil, err
+		}
+	}
+
+	if o.baseURL == "" {
+		return nil, fmt.Errorf("clair url is required")
+	}
+	baseURL, err := url.Parse(strings.TrimSuffix(o.baseURL, "/"))
+	if err != nil {
+		return nil, fmt.Errorf("invalid clair url %s: %v", o.baseURL, err)
+	}
+	if baseURL.Scheme != "http" && baseURL.Scheme != "https" {
+		return nil, fmt.Errorf("invalid clair url %s: scheme must be http or https", o.baseURL)
+	}
+	if baseURL.Host == "" {
+		return nil, fmt.Errorf("invalid clair url %s: missing host", o.baseURL)
+	}
+
+	transport := o.transport
+	if transport == nil {
+		if transport, err = newTransport(o); err != nil {
+			return nil, err
+		}
+	}
+
+	return &Client{
+		baseURL:     baseURL,
+		httpClient:  &http.Client{Transport: &instrumentedTransport{next: transport, basePath: baseURL.Path}},
+		timeout:     o.timeout,
+		auth:        o.authenticator,
+		RetryPolicy: o.retryPolicy,
+		Breaker:     o.breaker,
+	}, nil
+}
+
+func newTransport(o *clientOptions) (*http.Transport, error) {
+	tlsConfig := &tls.Config{
+		MinVersion:         tls.VersionTLS12,
+		InsecureSkipVerify: o.insecureSkipVerify, //nolint:gosec
+	}
+	if o.caFile != "" {
+		pool, err := x509.SystemCertPool()
+		if err != nil || pool == nil {
+			pool = x509.NewCertPool()
+		}
+		pem, err := ioutil.ReadFile(o.caFile)
+		if err != nil {
+			return nil, fmt.Errorf("read clair ca %s err %v", o.caFile, err)
+		}
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificate found in clair ca %s", o.caFile)
+		}
+		tlsConfig.RootCAs = pool
+	}
+	if o.certFile != "" {
+		cert, err := tls.LoadX509KeyPair(o.certFile, o.keyFile)
+		if err != nil {
+			return nil, fmt.Errorf("load clair client cert %s,key %s err %v", o.certFile, o.keyFile, err)
+		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	}
+
+	proxy := http.ProxyFromEnvironment
+	switch o.proxy {
+	case "":
+	case "direct":
+		proxy = nil
+	default:
+		proxyURL, err := url.Parse(o.proxy)
+		if err != nil {
+			return nil, fmt.Errorf("invalid proxy url %s: %v", o.proxy, err)
+		}
+		proxy = http.ProxyURL(proxyURL)
+	}
+
+	return &http.Transport{
+		Proxy: proxy,
+		DialContext: (&net.Dialer{
+			Timeout:   30 * time.Second,
+			KeepAlive: 30 * time.Second,
+		}).DialContext,
+		TLSClientConfig:       tlsConfig,
+		ForceAttemptHTTP2:     true,
+		MaxIdleConns:          defaultMaxIdleConns,
+		MaxIdleConnsPerHost:   defaultMaxIdleConns,
+		IdleConnTimeout:       90 * time.Second,
+		TLSHandshakeTimeout:   10 * time.Second,
+		ExpectContinueTimeout: 1 * time.Second,
+	}, nil
+}
@@ -0,0 +1,57 @@
+package clair
+
+import (
+	"context"
+	"errors"
+
+	"github.com/wadeling/clair-client/pkg/logging"
+	"github.com/wadeling/clair-client/pkg/retry"
+)
+
+// withRetry runs a single clair request with the client's retry policy and circuit breaker.
+// Only ErrClairUnavailable (5xx,timeouts,connection errors) is retried; a 4xx means clair
+// is up and counts as success for the breaker.
+func (c *Client) withRetry(ctx context.Context, op func(ctx context.Context) error) error {
+	policy := retry.DefaultPolicy
+	if c.RetryPolicy != nil {
+		policy = *c.RetryPolicy
+	}
+
+	attempt := 0
+	return policy.Do(ctx, func(ctx context.Context) error {
+		attempt++
+		if c.Breaker != nil {
+			if err := c.Breaker.Allow(); err != nil {
+				return retry.Permanent(&Error{Op: "request", Kind: ErrClairUnavailable, Err: err})
+			}
+		}
+
+		attemptCtx := ctx
+		if c.timeout > 0 {
+			var cancel context.CancelFunc
+			attemptCtx, cancel = context.WithTimeout(ctx, c.timeout)
+			defer cancel()
+		}
+		err := op(attemptCtx)
+		var clairErr *Error
+		if ctx.Err() != nil && errors.As(err, &clairErr) && clairErr.StatusCode == 0 {
+			// cancelled by the caller,clair itself is not unavailable
+			clairErr.Kind = nil
+		}
+		if c.Breaker != nil {
+			if errors.Is(err, ErrClairUnavailable) {
+				c.Breaker.Failure()
+			} else if ctx.Err() == nil {
+				c.Breaker.Success()
+			} else {
+				c.Breaker.Release()
+			}
+		}
+		if err != nil && errors.Is(err, ErrClairUnavailable) && attempt < policy.MaxAttempts {
+			logging.FromContext(ctx).WithField("attempt", attempt).Warnf("clair request failed (attempt %d/%d),retry: %v", attempt, policy.MaxAttempts, err)
+		}
+		return err
+	}, func(err error) bool {
+		return errors.Is(err, ErrClairUnavailable)
+	})
+}
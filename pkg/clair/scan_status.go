@@ -0,0 +1,206 @@
+package clair
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/wadeling/clair-client/pkg/logging"
+)
+
+const (
+	layerPollInterval = 1 * time.Second
+	layerPollTimeout  = 30 * time.Second
+)
+
+type ScanState string
+
+const (
+	// ScanComplete all layers are known to clair
+	ScanComplete ScanState = "complete"
+	// ScanPartial some layers are known to clair,the result of TopLayer misses the failed layers
+	ScanPartial ScanState = "partial"
+	// ScanUnsupportedOS clair can not detect the OS and/or package manager of the image
+	ScanUnsupportedOS ScanState = "unsupported_os"
+	// ScanFailed no layer is known to clair
+	ScanFailed ScanState = "failed"
+)
+
+// LayerRequest is a layer to post to clair,Path is where clair downloads it from
+// and Headers are sent along with that download
+type LayerRequest struct {
+	Name    string
+	Path    string
+	Headers map[string]string
+	// HeadersFunc,if set,replaces Headers right before the layer is posted,
+	// for short lived registry tokens
+	HeadersFunc func(ctx context.Context) (map[string]string, error)
+	// PostedFunc,if set,is called once the layer is posted or failed,err is nil on success
+	PostedFunc func(err error)
+}
+
+// LayerOutcome is the submission result of one layer
+type LayerOutcome struct {
+	Name     string `json:"name"`
+	Parent   string `json:"parent,omitempty"`
+	Attempts int    `json:"attempts"`
+	Posted   bool   `json:"posted"`
+	Error    string `json:"error,omitempty"`
+	// Downloaded tells whether clair downloaded the layer from our file server,
+	// nil if unknown,e.g. clair pulled it from the registry
+	Downloaded *bool `json:"downloaded,omitempty"`
+}
+
+// ScanStatus is the result of posting a layer chain to clair
+type ScanStatus struct {
+	State  ScanState      `json:"state"`
+	Layers []LayerOutcome `json:"layers"`
+	// TopLayer is the highest layer known to clair,its vulnerabilities include all layers below
+	TopLayer string `json:"topLayer,omitempty"`
+	// FailedLayers failed or were skipped because a layer below failed
+	FailedLayers []string `json:"failedLayers,omitempty"`
+}
+
+// ScheduleLayerChain posts layers to clair in order,each with the previous one as parent.
+// Transient errors are retried by the client's retry policy. When clair answers that the parent
+// layer is unknown the parent is posted again once before retrying. The chain stops at the first
+// layer that can not be posted,everything below it is still usable through TopLayer.
+func (c *Client) ScheduleLayerChain(ctx context.Context, layers []LayerRequest) *ScanStatus {
+	status := &ScanStatus{Layers: make([]LayerOutcome, len(layers))}
+	for i, l := range layers {
+		status.Layers[i] = LayerOutcome{Name: l.Name}
+		if i > 0 {
+			status.Layers[i].Parent = layers[i-1].Name
+		}
+	}
+
+	for i := range layers {
+		outcome := &status.Layers[i]
+		layerCtx := logging.WithFields(ctx, log.Fields{logging.FieldLayer: outcome.Name, logging.FieldLayerIndex: i})
+		err := c.scheduleLayerInChain(layerCtx, layers, i, outcome)
+		if layers[i].PostedFunc != nil {
+			layers[i].PostedFunc(err)
+		}
+		if err == nil {
+			outcome.Posted = true
+			status.TopLayer = outcome.Name
+			logging.FromContext(layerCtx).Info("post layer to clair ok")
+			continue
+		}
+
+		outcome.Error = err.Error()
+		logging.FromContext(layerCtx).WithField("parent", outcome.Parent).Errorf("post layer to clair err %v", err)
+		for _, l := range layers[i:] {
+			status.FailedLayers = append(status.FailedLayers, l.Name)
+		}
+		switch {
+		case errors.Is(err, ErrUnsupportedOS):
+			status.State = ScanUnsupportedOS
+		case status.TopLayer == "":
+			status.State = ScanFailed
+		default:
+			status.State = ScanPartial
+		}
+		return status
+	}
+
+	status.State = ScanComplete
+	if len(layers) == 0 {
+		status.State = ScanFailed
+		return status
+	}
+	if err := c.WaitForLayer(ctx, status.TopLayer); err != nil {
+		logging.FromContext(ctx).WithField(logging.FieldLayer, status.TopLayer).Errorf("wait for layer in clair err %v", err)
+		status.State = ScanFailed
+		status.TopLayer = ""
+	}
+	return status
+}
+
+func (c *Client) scheduleLayerInChain(ctx context.Context, layers []LayerRequest, i int, outcome *LayerOutcome) error {
+	outcome.Attempts++
+	err := c.scheduleLayerRequest(ctx, layers[i], outcome.Parent)
+	if !errors.Is(err, ErrParentUnknown) || i == 0 {
+		return err
+	}
+
+	// clair lost the parent,e.g. its database was reset during the scan. post it again
+	logging.FromContext(ctx).WithField("parent", outcome.Parent).Warn("parent layer unknown to clair,post it again")
+	parentOf := ""
+	if i > 1 {
+		parentOf = layers[i-2].Name
+	}
+	if perr := c.scheduleLayerRequest(ctx, layers[i-1], parentOf); perr != nil {
+		return fmt.Errorf("post parent layer %s again err %w", layers[i-1].Name, perr)
+	}
+	outcome.Attempts++
+	return c.scheduleLayerRequest(ctx, layers[i], outcome.Parent)
+}
+
+func (c *Client) scheduleLayerRequest(ctx context.Context, l LayerRequest, parent string) error {
+	headers := l.Headers
+	if l.HeadersFunc != nil {
+		var err error
+		if headers, err = l.HeadersFunc(ctx); err != nil {
+			return fmt.Errorf("get download headers of layer %s err %w", l.Name, err)
+		}
+	}
+	return c.ScheduleLayerScanInClairWithHeaders(ctx, l.Path, headers, l.Name, parent)
+}
+
+// WaitForLayer polls clair until the layer is known,each poll goes through the retry policy
+// and circuit breaker of the client
+func (c *Client) WaitForLayer(ctx context.Context, layerName string) error {
+	ctx, cancel := context.WithTimeout(ctx, layerPollTimeout)
+	defer cancel()
+	for {
+		code, err := c.getLayerStatus(ctx, layerName)
+		if err != nil {
+			return err
+		}
+		if code == http.StatusOK {
+			return nil
+		}
+		if code != http.StatusNotFound {
+			return fmt.Errorf("clair returned %d for layer %s", code, layerName)
+		}
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("layer %s not found in clair: %v", layerName, ctx.Err())
+		case <-time.After(layerPollInterval):
+		}
+	}
+}
+
+// getLayerStatus returns the status code clair answers for the layer,
+// server errors are retried and returned as errors
+func (c *Client) getLayerStatus(ctx context.Context, layerName string) (int, error) {
+	var code int
+	err := c.withRetry(ctx, func(ctx context.Context) error {
+		var err error
+		code, err = c.fetchLayerStatus(ctx, layerName)
+		return err
+	})
+	return code, err
+}
+
+func (c *Client) fetchLayerStatus(ctx context.Context, layerName string) (int, error) {
+	request, err := c.newRequest(ctx, "GET", layerPath(layerName), nil)
+	if err != nil {
+		return 0, err
+	}
+	response, err := c.httpClient.Do(request)
+	if err != nil {
+		return 0, newTransportError("get layer status", layerName, err)
+	}
+	defer response.Body.Close()
+	if response.StatusCode >= http.StatusInternalServerError {
+		body, _ := ioutil.ReadAll(response.Body)
+		return response.StatusCode, newResponseError("get layer status", layerName, response.StatusCode, body)
+	}
+	return response.StatusCode, nil
+}
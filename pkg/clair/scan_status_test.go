@@ -0,0 +1,246 @@
+package clair
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/wadeling/clair-client/pkg/retry"
+)
+
+// fakeClair answers layer posts like clair v1,a posted layer is known once its parent is known
+type fakeClair struct {
+	mu     sync.Mutex
+	known  map[string]bool
+	posts  []string
+	parent map[string]string
+	// fail answers posts of a layer with a status and message
+	fail map[string]failure
+	// forget drops a layer right before the first post of the key layer,like a reset clair database
+	forget map[string]string
+	// getStatus answers GET of a layer instead of its known state,if set
+	getStatus int
+}
+
+type failure struct {
+	code    int
+	message string
+	// skip is the number of posts answered normally before the failure
+	skip int
+}
+
+func newFakeClair() *fakeClair {
+	return &fakeClair{
+		known:  make(map[string]bool),
+		parent: make(map[string]string),
+		fail:   make(map[string]failure),
+		forget: make(map[string]string),
+	}
+}
+
+func (f *fakeClair) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if r.Method == http.MethodGet {
+		name := strings.TrimPrefix(r.URL.Path, "/v1/layers/")
+		switch {
+		case f.getStatus != 0:
+			w.WriteHeader(f.getStatus)
+		case f.known[name]:
+			json.NewEncoder(w).Encode(NewerLayerEnvelope{Layer: NewerLayer{Name: name}})
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+		return
+	}
+
+	var envelope NewerLayerEnvelope
+	if err := json.NewDecoder(r.Body).Decode(&envelope); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	l := envelope.Layer
+	f.posts = append(f.posts, l.Name)
+	f.parent[l.Name] = l.ParentName
+	if lost, ok := f.forget[l.Name]; ok {
+		delete(f.forget, l.Name)
+		delete(f.known, lost)
+	}
+	respond := func(code int, message string) {
+		w.WriteHeader(code)
+		json.NewEncoder(w).Encode(NewerLayerEnvelope{Error: &ClairEnvelopeError{Message: message}})
+	}
+	if fl, ok := f.fail[l.Name]; ok {
+		if fl.skip == 0 {
+			respond(fl.code, fl.message)
+			return
+		}
+		fl.skip--
+		f.fail[l.Name] = fl
+	}
+	if l.ParentName != "" && !f.known[l.ParentName] {
+		respond(http.StatusBadRequest, "worker: parent layer is unknown, it must be processed first")
+		return
+	}
+	f.known[l.Name] = true
+	w.WriteHeader(http.StatusCreated)
+}
+
+func TestScheduleLayerChain(t *testing.T) {
+	tests := []struct {
+		name      string
+		layers    []string
+		setup     func(f *fakeClair)
+		wantState ScanState
+		wantTop   string
+		wantFail  []string
+		wantPosts []string
+	}{
+		{name: "complete", layers: []string{"l1", "l2", "l3"},
+			wantState: ScanComplete, wantTop: "l3", wantPosts: []string{"l1", "l2", "l3"}},
+		{name: "no layers", wantState: ScanFailed},
+		{name: "partial", layers: []string{"l1", "l2", "l3"},
+			setup: func(f *fakeClair) {
+				f.fail["l2"] = failure{http.StatusBadRequest, "could not download layer", 0}
+			},
+			wantState: ScanPartial, wantTop: "l1", wantFail: []string{"l2", "l3"}, wantPosts: []string{"l1", "l2"}},
+		{name: "unsupported os", layers: []string{"l1", "l2"},
+			setup: func(f *fakeClair) {
+				f.fail["l1"] = failure{http.StatusUnprocessableEntity, "worker: OS and/or package manager are not supported", 0}
+			},
+			wantState: ScanUnsupportedOS, wantFail: []string{"l1", "l2"}, wantPosts: []string{"l1"}},
+		{name: "extract error is no unsupported os", layers: []string{"l1"},
+			setup: func(f *fakeClair) {
+				f.fail["l1"] = failure{http.StatusUnprocessableEntity, "worker: could not extract layer", 0}
+			},
+			wantState: ScanFailed, wantFail: []string{"l1"}, wantPosts: []string{"l1"}},
+		{name: "failed", layers: []string{"l1", "l2"},
+			setup: func(f *fakeClair) {
+				f.fail["l1"] = failure{http.StatusBadRequest, "could not download layer", 0}
+			},
+			wantState: ScanFailed, wantFail: []string{"l1", "l2"}, wantPosts: []string{"l1"}},
+		{name: "parent unknown is posted again", layers: []string{"l1", "l2", "l3"},
+			setup: func(f *fakeClair) {
+				f.forget["l2"] = "l1"
+			},
+			wantState: ScanComplete, wantTop: "l3", wantPosts: []string{"l1", "l2", "l1", "l2", "l3"}},
+		{name: "parent posted again fails", layers: []string{"l1", "l2"},
+			setup: func(f *fakeClair) {
+				f.forget["l2"] = "l1"
+				f.fail["l1"] = failure{http.StatusBadRequest, "could not download layer", 1}
+			},
+			wantState: ScanPartial, wantTop: "l1", wantFail: []string{"l2"}, wantPosts: []string{"l1", "l2", "l1"}},
+		{name: "top layer not readable", layers: []string{"l1"},
+			setup: func(f *fakeClair) {
+				f.getStatus = http.StatusForbidden
+			},
+			wantState: ScanFailed, wantPosts: []string{"l1"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fake := newFakeClair()
+			if tt.setup != nil {
+				tt.setup(fake)
+			}
+			srv := httptest.NewServer(fake)
+			defer srv.Close()
+			c, err := NewClient(WithBaseURL(srv.URL), WithRetryPolicy(retry.NoRetry))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			var layers []LayerRequest
+			for _, name := range tt.layers {
+				layers = append(layers, LayerRequest{Name: name, Path: "http://fs/" + name + "/layer.tar"})
+			}
+			status := c.ScheduleLayerChain(context.Background(), layers)
+
+			if status.State != tt.wantState {
+				t.Errorf("state = %s,want %s", status.State, tt.wantState)
+			}
+			if status.TopLayer != tt.wantTop {
+				t.Errorf("top layer = %q,want %q", status.TopLayer, tt.wantTop)
+			}
+			if !reflect.DeepEqual(status.FailedLayers, tt.wantFail) {
+				t.Errorf("failed layers = %v,want %v", status.FailedLayers, tt.wantFail)
+			}
+			if !reflect.DeepEqual(fake.posts, tt.wantPosts) {
+				t.Errorf("posts = %v,want %v", fake.posts, tt.wantPosts)
+			}
+			for i, outcome := range status.Layers {
+				if i > 0 && outcome.Parent != tt.layers[i-1] {
+					t.Errorf("layer %s parent = %q,want %q", outcome.Name, outcome.Parent, tt.layers[i-1])
+				}
+				if got := fake.parent[outcome.Name]; outcome.Attempts > 0 && got != outcome.Parent {
+					t.Errorf("layer %s posted with parent %q,want %q", outcome.Name, got, outcome.Parent)
+				}
+			}
+		})
+	}
+}
+
+func TestScheduleLayerChainHeadersFunc(t *testing.T) {
+	var got []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodGet {
+			return
+		}
+		var envelope NewerLayerEnvelope
+		json.NewDecoder(r.Body).Decode(&envelope)
+		got = append(got, envelope.Layer.Headers["Authorization"])
+		w.WriteHeader(http.StatusCreated)
+	}))
+	defer srv.Close()
+	c, err := NewClient(WithBaseURL(srv.URL), WithRetryPolicy(retry.NoRetry))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tokens := 0
+	headersFunc := func(ctx context.Context) (map[string]string, error) {
+		tokens++
+		return map[string]string{"Authorization": "Bearer " + strconv.Itoa(tokens)}, nil
+	}
+	status := c.ScheduleLayerChain(context.Background(), []LayerRequest{
+		{Name: "l1", Headers: map[string]string{"Authorization": "static"}},
+		{Name: "l2", Headers: map[string]string{"Authorization": "static"}, HeadersFunc: headersFunc},
+		{Name: "l3", HeadersFunc: headersFunc},
+	})
+	if status.State != ScanComplete {
+		t.Fatalf("state = %s,want %s", status.State, ScanComplete)
+	}
+	if want := []string{"static", "Bearer 1", "Bearer 2"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("headers = %v,want %v", got, want)
+	}
+}
+
+func TestScheduleLayerChainPostedFunc(t *testing.T) {
+	fake := newFakeClair()
+	fake.fail["l2"] = failure{http.StatusBadRequest, "could not download layer", 0}
+	srv := httptest.NewServer(fake)
+	defer srv.Close()
+	c, err := NewClient(WithBaseURL(srv.URL), WithRetryPolicy(retry.NoRetry))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var got []string
+	var layers []LayerRequest
+	for _, name := range []string{"l1", "l2", "l3"} {
+		name := name
+		layers = append(layers, LayerRequest{Name: name, PostedFunc: func(err error) {
+			got = append(got, name+":"+strconv.FormatBool(err == nil))
+		}})
+	}
+	c.ScheduleLayerChain(context.Background(), layers)
+	// l3 is skipped after l2 failed,it is never posted
+	if want := []string{"l1:true", "l2:false"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("posted calls = %v,want %v", got, want)
+	}
+}
@@ -0,0 +1,359 @@
+package config
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net"
+	"sort"
+	"strings"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/wadeling/clair-client/pkg/model"
+	"github.com/wadeling/clair-client/pkg/progress"
+	"github.com/wadeling/clair-client/util"
+	"gopkg.in/yaml.v2"
+)
+
+// Config holds all settings of clair-client. Values are taken from, in increasing priority:
+// defaults, the yaml config file, CLAIR_CLIENT_* environment variables and command line flags.
+type Config struct {
+	Registry   RegistryConfig   `yaml:"registry"`
+	Image      ImageConfig      `yaml:"image"`
+	Clair      ClairConfig      `yaml:"clair"`
+	FileServer FileServerConfig `yaml:"fileServer"`
+	Output     OutputConfig     `yaml:"output"`
+	Policy     PolicyConfig     `yaml:"policy"`
+	Tracing    TracingConfig    `yaml:"tracing"`
+	Log        LogConfig        `yaml:"log"`
+	Serve      ServeConfig      `yaml:"serve"`
+}
+
+type RegistryConfig struct {
+	URL        string `yaml:"url"`
+	Repository string `yaml:"repository"`
+	Image      string `yaml:"image"`
+	Tag        string `yaml:"tag"`
+	// Username and Password are optional,see registryWrap.ResolveCredentials
+	Username string `yaml:"username"`
+	Password string `yaml:"password"`
+	// Insecure retries without TLS verification when the registry cert is invalid
+	Insecure bool `yaml:"insecure"`
+	// Direct lets clair pull layers from the registry,no local file server
+	Direct bool `yaml:"direct"`
+}
+
+// ImageConfig selects a local image instead of a registry image
+type ImageConfig struct {
+	DockerArchive string `yaml:"dockerArchive"`
+	OCILayout     string `yaml:"ociLayout"`
+	Rootfs        string `yaml:"rootfs"`
+	Ref           string `yaml:"ref"`
+}
+
+type ClairConfig struct {
+	URL  string `yaml:"url"`
+	IP   string `yaml:"ip"`
+	Port int    `yaml:"port"`
+
+	CA      string        `yaml:"ca"`
+	Cert    string        `yaml:"cert"`
+	Key     string        `yaml:"key"`
+	Timeout time.Duration `yaml:"timeout"`
+	Proxy   string        `yaml:"proxy"`
+	// ScanTimeout limits a whole scan
+	ScanTimeout time.Duration `yaml:"scanTimeout"`
+
+	Token     string `yaml:"token"`
+	User      string `yaml:"user"`
+	Password  string `yaml:"password"`
+	PSK       string `yaml:"psk"`
+	PSKIssuer string `yaml:"pskIssuer"`
+}
+
+type FileServerConfig struct {
+	// Port 0 picks a free port,so several scans can run at the same time
+	Port    int    `yaml:"port"`
+	RootDir string `yaml:"rootDir"`
+	// AdvertiseAddr is the hostname or ip,with optional port,clair downloads layers from.
+	// Default the local address routing to clair.
+	AdvertiseAddr string `yaml:"advertiseAddr"`
+	// Stream serves layers straight from the image source when clair downloads them,nothing is staged on disk
+	Stream bool `yaml:"stream"`
+	// BindAddr is the ip to listen on,default the advertised ip,or all interfaces if AdvertiseAddr is set
+	BindAddr string `yaml:"bindAddr"`
+	// URLTTL is the validity of the signed layer urls
+	URLTTL        time.Duration `yaml:"urlTTL"`
+	TLSCert       string        `yaml:"tlsCert"`
+	TLSKey        string        `yaml:"tlsKey"`
+	TLSSelfSigned bool          `yaml:"tlsSelfSigned"`
+	TLSCAOut      string        `yaml:"tlsCAOut"`
+	// TLSCAKeyOut keeps the key of the self signed CA,an existing CA is reused
+	TLSCAKeyOut string `yaml:"tlsCAKeyOut"`
+	// Metrics serves prometheus metrics on /metrics of the file server
+	Metrics bool `yaml:"metrics"`
+}
+
+// ServeConfig is the http api of the serve command
+type ServeConfig struct {
+	Listen string `yaml:"listen"`
+	// Token is the bearer token api clients must send
+	Token string `yaml:"token"`
+}
+
+type OutputConfig struct {
+	ResultFile   string `yaml:"resultFile"`
+	VulnNameFile string `yaml:"vulnNameFile"`
+	// PackagesFile is the inventory of all packages of the image,empty skips it
+	PackagesFile string `yaml:"packagesFile"`
+	// GroupByCVE writes one result per vulnerability id with all affected packages,
+	// default one per id and package version
+	GroupByCVE bool `yaml:"groupByCVE"`
+	// Progress is auto,bar,log or none,auto draws a bar on a terminal and logs otherwise
+	Progress string `yaml:"progress"`
+}
+
+type PolicyConfig struct {
+	// FailOnSeverity fails the scan when a vulnerability of this or a higher severity is found,
+	// empty disables it
+	FailOnSeverity string `yaml:"failOnSeverity"`
+}
+
+// TracingConfig selects where opentelemetry spans are exported to
+type TracingConfig struct {
+	// Exporter is none,stdout or otlp
+	Exporter string `yaml:"exporter"`
+	// Endpoint is the host:port of the OTLP/HTTP collector,default $OTEL_EXPORTER_OTLP_ENDPOINT
+	Endpoint string `yaml:"endpoint"`
+	// Insecure sends spans to the collector over plain http
+	Insecure bool `yaml:"insecure"`
+}
+
+type LogConfig struct {
+	// Format is text or json
+	Format string `yaml:"format"`
+	// Level is a logrus level,like debug,info or warn
+	Level string `yaml:"level"`
+}
+
+// Default returns the built-in defaults
+func Default() *Config {
+	return &Config{
+		Registry: RegistryConfig{
+			Insecure: true,
+		},
+		Clair: ClairConfig{
+			Timeout:     5 * time.Minute,
+			ScanTimeout: 10 * time.Minute,
+			PSKIssuer:   "clair-client",
+		},
+		FileServer: FileServerConfig{
+			Port:        0,
+			RootDir:     "layerManage",
+			URLTTL:      30 * time.Minute,
+			TLSCAOut:    "clair-client-ca.pem",
+			TLSCAKeyOut: "clair-client-ca-key.pem",
+		},
+		Log: LogConfig{
+			Format: "text",
+			Level:  "info",
+		},
+		Serve: ServeConfig{
+			Listen: ":8080",
+		},
+		Output: OutputConfig{
+			ResultFile:   "scan_result.txt",
+			VulnNameFile: "scan_vuln_name.txt",
+			PackagesFile: "packages.json",
+			Progress:     progress.ModeAuto,
+		},
+	}
+}
+
+// LoadFile merges the yaml file into c,settings missing in the file keep their value
+func (c *Config) LoadFile(path string) error {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("read config file %s err %v", path, err)
+	}
+	if err := yaml.UnmarshalStrict(data, c); err != nil {
+		return fmt.Errorf("parse config file %s err %v", path, err)
+	}
+	return nil
+}
+
+// LocalImage reports whether a local image source is configured instead of a registry image
+func (c *Config) LocalImage() bool {
+	return c.Image.DockerArchive != "" || c.Image.OCILayout != "" || c.Image.Rootfs != ""
+}
+
+// Section is a group of settings a command needs,see Validate
+type Section int
+
+const (
+	// SectionImage the registry image or local image to scan
+	SectionImage Section = iota
+	SectionClair
+	SectionFileServer
+	SectionPolicy
+	SectionTracing
+	SectionLog
+	SectionOutput
+	// SectionServe the http api,only validated when given
+	SectionServe
+)
+
+// allSections are the sections of a scan
+var allSections = []Section{SectionImage, SectionClair, SectionFileServer, SectionPolicy, SectionTracing, SectionLog, SectionOutput}
+
+// Validate checks required settings of the given sections are present and consistent,
+// the sections of a scan when none is given
+func (c *Config) Validate(sections ...Section) error {
+	if len(sections) == 0 {
+		sections = allSections
+	}
+	var problems []string
+	for _, section := range sections {
+		switch section {
+		case SectionImage:
+			problems = append(problems, c.validateImage()...)
+		case SectionClair:
+			problems = append(problems, c.validateClair()...)
+		case SectionFileServer:
+			problems = append(problems, c.validateFileServer()...)
+		case SectionPolicy:
+			problems = append(problems, c.validatePolicy()...)
+		case SectionTracing:
+			problems = append(problems, c.validateTracing()...)
+		case SectionLog:
+			problems = append(problems, c.validateLog()...)
+		case SectionOutput:
+			problems = append(problems, c.validateOutput()...)
+		case SectionServe:
+			problems = append(problems, c.validateServe()...)
+		}
+	}
+
+	if len(problems) > 0 {
+		sort.Strings(problems)
+		return fmt.Errorf("invalid configuration:\n  %s", strings.Join(problems, "\n  "))
+	}
+	return nil
+}
+
+func missing(key string) string {
+	return fmt.Sprintf("%s is required (%s)", key, EnvName(key))
+}
+
+func (c *Config) validateImage() []string {
+	var problems []string
+	sources := 0
+	for _, s := range []string{c.Image.DockerArchive, c.Image.OCILayout, c.Image.Rootfs} {
+		if s != "" {
+			sources++
+		}
+	}
+	if sources > 1 {
+		problems = append(problems, "only one of image.dockerArchive,image.ociLayout and image.rootfs can be set")
+	}
+	if sources == 0 {
+		for key, v := range map[string]string{
+			"registry.url":        c.Registry.URL,
+			"registry.repository": c.Registry.Repository,
+			"registry.image":      c.Registry.Image,
+			"registry.tag":        c.Registry.Tag,
+		} {
+			if v == "" {
+				problems = append(problems, missing(key))
+			}
+		}
+	} else if c.Registry.Direct {
+		problems = append(problems, "registry.direct only works for registry images")
+	}
+	return problems
+}
+
+func (c *Config) validateClair() []string {
+	var problems []string
+	if c.Clair.URL == "" && (c.Clair.IP == "" || c.Clair.Port == 0) {
+		problems = append(problems, missing("clair.url"))
+	}
+	if (c.Clair.Cert == "") != (c.Clair.Key == "") {
+		problems = append(problems, "clair.cert and clair.key must be set together")
+	}
+	return problems
+}
+
+func (c *Config) validateFileServer() []string {
+	var problems []string
+	if (c.FileServer.TLSCert == "") != (c.FileServer.TLSKey == "") {
+		problems = append(problems, "fileServer.tlsCert and fileServer.tlsKey must be set together")
+	}
+	if c.FileServer.Port < 0 || c.FileServer.Port > 65535 {
+		problems = append(problems, fmt.Sprintf("fileServer.port %d is out of range", c.FileServer.Port))
+	}
+	if c.FileServer.AdvertiseAddr != "" {
+		if _, _, err := util.ParseAdvertiseAddr(c.FileServer.AdvertiseAddr); err != nil {
+			problems = append(problems, fmt.Sprintf("fileServer.advertiseAddr: %v", err))
+		}
+	}
+	if c.FileServer.BindAddr != "" && net.ParseIP(util.TrimBrackets(c.FileServer.BindAddr)) == nil {
+		problems = append(problems, fmt.Sprintf("fileServer.bindAddr %s is not an ip", c.FileServer.BindAddr))
+	}
+	if c.FileServer.URLTTL <= 0 {
+		problems = append(problems, "fileServer.urlTTL must be positive")
+	}
+	return problems
+}
+
+func (c *Config) validatePolicy() []string {
+	if c.Policy.FailOnSeverity != "" && model.SeverityRank(c.Policy.FailOnSeverity) < 0 {
+		return []string{fmt.Sprintf("policy.failOnSeverity %s is not one of %s",
+			c.Policy.FailOnSeverity, strings.Join(model.Severities, ","))}
+	}
+	return nil
+}
+
+func (c *Config) validateTracing() []string {
+	switch c.Tracing.Exporter {
+	case "", "none", "stdout", "otlp":
+		return nil
+	}
+	return []string{fmt.Sprintf("tracing.exporter %s is not one of none,stdout,otlp", c.Tracing.Exporter)}
+}
+
+func (c *Config) validateLog() []string {
+	var problems []string
+	switch c.Log.Format {
+	case "", "text", "json":
+	default:
+		problems = append(problems, fmt.Sprintf("log.format %s is not one of text,json", c.Log.Format))
+	}
+	if c.Log.Level != "" {
+		if _, err := log.ParseLevel(c.Log.Level); err != nil {
+			problems = append(problems, fmt.Sprintf("log.level: %v", err))
+		}
+	}
+	return problems
+}
+
+func (c *Config) validateOutput() []string {
+	switch c.Output.Progress {
+	case "", progress.ModeAuto, progress.ModeBar, progress.ModeLog, progress.ModeNone:
+		return nil
+	}
+	return []string{fmt.Sprintf("output.progress %s is not one of %s",
+		c.Output.Progress, strings.Join(progress.Modes, ","))}
+}
+
+func (c *Config) validateServe() []string {
+	var problems []string
+	if c.Serve.Listen == "" {
+		problems = append(problems, missing("serve.listen"))
+	}
+	if c.Serve.Token == "" {
+		// the api posts registry credentials and makes requests to registries,it is never open
+		problems = append(problems, missing("serve.token"))
+	}
+	return problems
+}
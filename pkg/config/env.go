@@ -0,0 +1,111 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// EnvPrefix of the environment variables overriding config file settings,
+// e.g. CLAIR_CLIENT_CLAIR_URL for clair.url and CLAIR_CLIENT_FILE_SERVER_URL_TTL for fileServer.urlTTL
+const EnvPrefix = "CLAIR_CLIENT_"
+
+var durationType = reflect.TypeOf(time.Duration(0))
+
+// EnvName returns the environment variable of a setting key like "clair.url"
+func EnvName(key string) string {
+	parts := strings.Split(key, ".")
+	for i, p := range parts {
+		parts[i] = upperSnake(p)
+	}
+	return EnvPrefix + strings.Join(parts, "_")
+}
+
+// upperSnake converts camelCase yaml keys,acronyms included: urlTTL -> URL_TTL,tlsCAOut -> TLS_CA_OUT
+func upperSnake(s string) string {
+	r := []rune(s)
+	var b strings.Builder
+	for i, c := range r {
+		if i > 0 && unicode.IsUpper(c) {
+			prevLower := unicode.IsLower(r[i-1])
+			nextLower := i+1 < len(r) && unicode.IsLower(r[i+1])
+			if prevLower || (unicode.IsUpper(r[i-1]) && nextLower) {
+				b.WriteByte('_')
+			}
+		}
+		b.WriteRune(unicode.ToUpper(c))
+	}
+	return b.String()
+}
+
+// ApplyEnv overrides settings from CLAIR_CLIENT_* environment variables
+func (c *Config) ApplyEnv() error {
+	return applyEnv(reflect.ValueOf(c).Elem(), "")
+}
+
+func applyEnv(v reflect.Value, prefix string) error {
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		name := strings.Split(field.Tag.Get("yaml"), ",")[0]
+		if name == "" || name == "-" {
+			continue
+		}
+		key := name
+		if prefix != "" {
+			key = prefix + "." + name
+		}
+
+		fv := v.Field(i)
+		if fv.Kind() == reflect.Struct && fv.Type() != durationType {
+			if err := applyEnv(fv, key); err != nil {
+				return err
+			}
+			continue
+		}
+
+		env := EnvName(key)
+		raw, ok := os.LookupEnv(env)
+		if !ok {
+			continue
+		}
+		if err := setValue(fv, raw); err != nil {
+			return fmt.Errorf("invalid %s=%q: %v", env, raw, err)
+		}
+	}
+	return nil
+}
+
+func setValue(v reflect.Value, raw string) error {
+	if v.Type() == durationType {
+		d, err := time.ParseDuration(raw)
+		if err != nil {
+			return err
+		}
+		v.SetInt(int64(d))
+		return nil
+	}
+	switch v.Kind() {
+	case reflect.String:
+		v.SetString(raw)
+	case reflect.Bool:
+		b, err := strconv.ParseBool(raw)
+		if err != nil {
+			return err
+		}
+		v.SetBool(b)
+	case reflect.Int:
+		n, err := strconv.Atoi(raw)
+		if err != nil {
+			return err
+		}
+		v.SetInt(int64(n))
+	default:
+		return fmt.Errorf("unsupported setting type %s", v.Type())
+	}
+	return nil
+}
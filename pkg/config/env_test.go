@@ -0,0 +1,100 @@
+package config
+
+import (
+	"os"
+	"testing"
+	"time"
+)
+
+func TestEnvName(t *testing.T) {
+	tests := []struct {
+		key  string
+		want string
+	}{
+		{"clair.url", "CLAIR_CLIENT_CLAIR_URL"},
+		{"clair.scanTimeout", "CLAIR_CLIENT_CLAIR_SCAN_TIMEOUT"},
+		{"fileServer.urlTTL", "CLAIR_CLIENT_FILE_SERVER_URL_TTL"},
+		{"fileServer.tlsCAOut", "CLAIR_CLIENT_FILE_SERVER_TLS_CA_OUT"},
+		{"fileServer.tlsCAKeyOut", "CLAIR_CLIENT_FILE_SERVER_TLS_CA_KEY_OUT"},
+		{"clair.psk", "CLAIR_CLIENT_CLAIR_PSK"},
+		{"clair.pskIssuer", "CLAIR_CLIENT_CLAIR_PSK_ISSUER"},
+		{"image.ociLayout", "CLAIR_CLIENT_IMAGE_OCI_LAYOUT"},
+		{"output.groupByCVE", "CLAIR_CLIENT_OUTPUT_GROUP_BY_CVE"},
+		{"serve.token", "CLAIR_CLIENT_SERVE_TOKEN"},
+	}
+	for _, tt := range tests {
+		if got := EnvName(tt.key); got != tt.want {
+			t.Errorf("EnvName(%s) = %s,want %s", tt.key, got, tt.want)
+		}
+	}
+}
+
+func TestApplyEnv(t *testing.T) {
+	tests := []struct {
+		name    string
+		env     map[string]string
+		check   func(c *Config) bool
+		wantErr bool
+	}{
+		{
+			name:  "string",
+			env:   map[string]string{"CLAIR_CLIENT_CLAIR_URL": "http://clair:6060"},
+			check: func(c *Config) bool { return c.Clair.URL == "http://clair:6060" },
+		},
+		{
+			name:  "int",
+			env:   map[string]string{"CLAIR_CLIENT_FILE_SERVER_PORT": "5566"},
+			check: func(c *Config) bool { return c.FileServer.Port == 5566 },
+		},
+		{
+			name:  "bool",
+			env:   map[string]string{"CLAIR_CLIENT_REGISTRY_INSECURE": "false"},
+			check: func(c *Config) bool { return !c.Registry.Insecure },
+		},
+		{
+			name:  "duration",
+			env:   map[string]string{"CLAIR_CLIENT_FILE_SERVER_URL_TTL": "5m"},
+			check: func(c *Config) bool { return c.FileServer.URLTTL == 5*time.Minute },
+		},
+		{
+			name:  "unset keeps the value",
+			env:   map[string]string{},
+			check: func(c *Config) bool { return c.FileServer.URLTTL == 30*time.Minute && c.Registry.Insecure },
+		},
+		{
+			name:  "empty value overrides",
+			env:   map[string]string{"CLAIR_CLIENT_OUTPUT_RESULT_FILE": ""},
+			check: func(c *Config) bool { return c.Output.ResultFile == "" },
+		},
+		{
+			name:    "invalid int",
+			env:     map[string]string{"CLAIR_CLIENT_FILE_SERVER_PORT": "http"},
+			wantErr: true,
+		},
+		{
+			name:    "invalid duration",
+			env:     map[string]string{"CLAIR_CLIENT_CLAIR_TIMEOUT": "5"},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for k, v := range tt.env {
+				os.Setenv(k, v)
+			}
+			defer func() {
+				for k := range tt.env {
+					os.Unsetenv(k)
+				}
+			}()
+			c := Default()
+			err := c.ApplyEnv()
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ApplyEnv() err %v,wantErr %v", err, tt.wantErr)
+			}
+			if err == nil && !tt.check(c) {
+				t.Errorf("ApplyEnv() did not apply %v: %+v", tt.env, c)
+			}
+		})
+	}
+}
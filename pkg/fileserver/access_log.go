@@ -0,0 +1,109 @@
+package fileserver
+
+import (
+	"net"
+	"net/http"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// LayerFetch counts the requests for one layer
+type LayerFetch struct {
+	Requests int `json:"requests"`
+	// Downloads are GET requests that sent the whole layer
+	Downloads int           `json:"downloads"`
+	Bytes     int64         `json:"bytes"`
+	Duration  time.Duration `json:"duration"`
+	// LastStatus and LastClient are from the latest request
+	LastStatus int    `json:"lastStatus"`
+	LastClient string `json:"lastClient"`
+}
+
+// LayerFetch returns the requests for the layer so far,e.g. to check clair downloaded it
+func (fs *FileServer) LayerFetch(digest string) LayerFetch {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	return fs.fetches[digest]
+}
+
+// statusRecorder remembers the status and size of a response
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+	bytes  int64
+}
+
+func (r *statusRecorder) WriteHeader(code int) {
+	r.status = code
+	r.ResponseWriter.WriteHeader(code)
+}
+
+func (r *statusRecorder) Write(b []byte) (int, error) {
+	if r.status == 0 {
+		r.status = http.StatusOK
+	}
+	n, err := r.ResponseWriter.Write(b)
+	r.bytes += int64(n)
+	return n, err
+}
+
+// accessLog logs every request and counts the signed requests per layer.
+// Anybody can send unsigned requests,counting them would let them fake downloads and grow the counts.
+func (fs *FileServer) accessLog(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		digest := ""
+		if r.Method == http.MethodGet || r.Method == http.MethodHead {
+			if dg, code, _ := fs.verifyLayerRequest(r); code == http.StatusOK {
+				digest = dg
+			}
+		}
+		rec := &statusRecorder{ResponseWriter: w}
+		aborted := true
+		defer func() {
+			if rec.status == 0 {
+				rec.status = http.StatusOK
+			}
+			fs.logRequest(r, rec, digest, time.Since(start), aborted)
+		}()
+		next.ServeHTTP(rec, r)
+		aborted = false
+	})
+}
+
+// logRequest logs a request,digest is the layer of a signed request or ""
+func (fs *FileServer) logRequest(r *http.Request, rec *statusRecorder, digest string, d time.Duration, aborted bool) {
+	client := r.RemoteAddr
+	if host, _, err := net.SplitHostPort(r.RemoteAddr); err == nil {
+		client = host
+	}
+	logger := fs.logger()
+	if digest != "" {
+		logger = fs.layerLogger(digest)
+	}
+	logger.WithFields(log.Fields{
+		"client":   client,
+		"method":   r.Method,
+		"path":     r.URL.Path,
+		"status":   rec.status,
+		"bytes":    rec.bytes,
+		"duration": d.String(),
+		"aborted":  aborted,
+	}).Info("access")
+	if digest == "" {
+		return
+	}
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	f := fs.fetches[digest]
+	f.Requests++
+	if r.Method == http.MethodGet && !aborted && (rec.status == http.StatusOK || rec.status == http.StatusPartialContent) {
+		f.Downloads++
+	}
+	f.Bytes += rec.bytes
+	f.Duration += d
+	f.LastStatus = rec.status
+	f.LastClient = client
+	fs.fetches[digest] = f
+}
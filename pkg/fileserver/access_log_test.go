@@ -0,0 +1,61 @@
+package fileserver
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestAccessLogCountsSignedRequests(t *testing.T) {
+	fs, err := NewFileServer(context.Background(), t.TempDir(), "10.0.0.5", "", 5566)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := fs.CreateHTTPRootDir(); err != nil {
+		t.Fatal(err)
+	}
+	defer fs.Cleanup()
+	if _, err := fs.SaveFile(context.Background(), testDigest, ioutil.NopCloser(strings.NewReader("layer"))); err != nil {
+		t.Fatal(err)
+	}
+	if err := fs.CreateFileServer(); err != nil {
+		t.Fatal(err)
+	}
+	signed := fs.LayerPath(testDigest)
+	other := "sha256:fedcba9876543210fedcba9876543210fedcba9876543210fedcba9876543210"
+
+	requests := []struct {
+		method string
+		target string
+		want   int
+	}{
+		{http.MethodGet, "/" + testDigest + "/" + LayerFileName, http.StatusForbidden},
+		{http.MethodGet, strings.Replace(signed, testDigest, other, 1), http.StatusForbidden},
+		{http.MethodGet, "/" + other + "/" + LayerFileName + "?expires=1&signature=00", http.StatusForbidden},
+		{http.MethodGet, "/metrics", http.StatusNotFound},
+		{http.MethodPost, signed, http.StatusMethodNotAllowed},
+		{http.MethodHead, signed, http.StatusOK},
+		{http.MethodGet, signed, http.StatusOK},
+	}
+	for _, req := range requests {
+		w := httptest.NewRecorder()
+		fs.server.Handler.ServeHTTP(w, httptest.NewRequest(req.method, req.target, nil))
+		if w.Code != req.want {
+			t.Errorf("%s %s = %d,want %d", req.method, req.target, w.Code, req.want)
+		}
+	}
+
+	if len(fs.fetches) != 1 {
+		t.Errorf("fetches of %d layers,want only the signed one: %v", len(fs.fetches), fs.fetches)
+	}
+	fetch := fs.LayerFetch(testDigest)
+	if fetch.Requests != 2 || fetch.Downloads != 1 || fetch.Bytes != int64(len("layer")) || fetch.LastStatus != http.StatusOK {
+		t.Errorf("LayerFetch() = %+v,want 2 requests,1 download of 5 bytes", fetch)
+	}
+	if fetch := fs.LayerFetch(other); fetch.Requests != 0 {
+		t.Errorf("unsigned requests counted for %s: %+v", other, fetch)
+	}
+}
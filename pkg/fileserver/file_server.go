@@ -2,12 +2,18 @@ package fileserver
 
 import (
 	"context"
+	"crypto/tls"
 	"fmt"
 	log "github.com/sirupsen/logrus"
+	"github.com/wadeling/clair-client/pkg/logging"
 	"io"
+	"io/ioutil"
+	"net"
 	"net/http"
 	"os"
 	"path/filepath"
+	"strconv"
+	"sync"
 	"time"
 )
 
@@ -20,67 +26,138 @@ type FileServer struct {
 	ctx            context.Context
 	rootPath       string
 	Port           int
-	ServerIp       string
-	ExternalIp     string
+	ServerIp       string //address to bind,empty for all interfaces
+	ExternalIp     string //hostname or ip clair downloads layers from
+	ExternalPort   int    //port clair connects to when it differs from Port,e.g. behind NAT
+
 	server         *http.Server
-	serverRootPath string //actual server root path: /tmp/xxx
+	serverRootPath string //layer directory of this run: /tmp/layerManage/run-xxx
+	signingKey     []byte //hmac key of layer urls,generated per run
+	tlsConfig      *tls.Config //nil serves plain http
+	URLTTL         time.Duration
+
+	// Streaming serves only layers added by AddStreamLayer,no layer directory is created
+	Streaming bool
+
+	mu      sync.Mutex
+	streams map[string]streamLayer //layers streamed from their source,see AddStreamLayer
+	fetches map[string]LayerFetch  //requests per layer digest
+	loggers map[string]*log.Entry  //logger of the scan that added a layer,see layerLogger
+	extra   map[string]http.Handler //handlers besides the layers,see Handle
 }
 
 func NewFileServer(ctx context.Context,rootPath ,externalIp,serverIp string,port int) (*FileServer,error) {
+	key, err := newSigningKey()
+	if err != nil {
+		return nil, err
+	}
 	fs := &FileServer{
 		ctx:        ctx,
 		rootPath:   rootPath,
 		Port:       port,
 		ServerIp:   serverIp,
 		ExternalIp: externalIp,
+		signingKey: key,
+		URLTTL:     DefaultLayerURLTTL,
+		streams:    make(map[string]streamLayer),
+		fetches:    make(map[string]LayerFetch),
+		loggers:    make(map[string]*log.Entry),
 	}
 
 	return fs,nil
 }
 
+// CreateHTTPRootDir creates the layer directory of this run below rootPath,a relative rootPath
+// is in the temp dir. Every run gets its own directory,other processes sharing rootPath
+// never see or remove its layers.
 func (fs *FileServer) CreateHTTPRootDir() error {
-	fs.serverRootPath = filepath.Join(os.TempDir(), FileServerRootDir)
-	return os.MkdirAll(fs.serverRootPath, os.ModePerm)
+	parent := fs.rootPath
+	if parent == "" {
+		parent = FileServerRootDir
+	}
+	if !filepath.IsAbs(parent) {
+		parent = filepath.Join(os.TempDir(), parent)
+	}
+	if err := os.MkdirAll(parent, os.ModePerm); err != nil {
+		return err
+	}
+	dir, err := ioutil.TempDir(parent, "run-")
+	if err != nil {
+		return err
+	}
+	fs.serverRootPath = dir
+	return nil
 }
 
 func (fs *FileServer) CreateFileServer() error {
 	mux := http.NewServeMux()
-	mux.Handle("/", http.FileServer(http.Dir(fs.serverRootPath)))
+	// only signed layer urls are served,see LayerURL
+	mux.HandleFunc("/", fs.serveLayer)
+	for pattern, h := range fs.extra {
+		mux.Handle(pattern, h)
+	}
 	fs.server = &http.Server{
-		// listen on all IPs
-		Addr:    fmt.Sprintf("%s:%d",fs.ServerIp, fs.Port),
-		Handler: mux,
+		Addr:    net.JoinHostPort(fs.ServerIp, strconv.Itoa(fs.Port)),
+		Handler: fs.accessLog(mux),
+		TLSConfig: fs.tlsConfig,
 	}
 	return nil
 }
 
+// Handle serves another handler besides the layers,like /metrics. Call it before Run.
+func (fs *FileServer) Handle(pattern string, h http.Handler) {
+	if fs.extra == nil {
+		fs.extra = make(map[string]http.Handler)
+	}
+	fs.extra[pattern] = h
+}
+
+// StartFileServer listens before it returns,so bind errors like a port in use are returned here.
+// With Port 0 an ephemeral port is picked and stored in Port.
 func (fs *FileServer) StartFileServer() error {
+	ln, err := net.Listen("tcp", fs.server.Addr)
+	if err != nil {
+		return fmt.Errorf("file server listen on %s err %v", fs.server.Addr, err)
+	}
+	fs.Port = ln.Addr().(*net.TCPAddr).Port
+	fs.server.Addr = ln.Addr().String()
+	fs.logger().Infof("Server layer manage file server on %s,scheme %s", fs.server.Addr, fs.scheme())
+
 	go func() {
-		if err := fs.server.ListenAndServe(); err != nil {
-			if err != nil {
-				log.Errorf("file server start err %v",err)
-			}
+		var err error
+		if fs.tlsConfig != nil {
+			// cert and key come from TLSConfig
+			err = fs.server.ServeTLS(ln, "", "")
+		} else {
+			err = fs.server.Serve(ln)
+		}
+		if err != nil && err != http.ErrServerClosed {
+			fs.logger().Errorf("file server serve err %v", err)
 		}
 	}()
-	// It takes some time to open the Port, just to be sure we wait a bit
-	time.Sleep(100 * time.Millisecond)
-	log.Infof("Server layer manage file server on Port %d", fs.Port)
 	return nil
 }
 
+// StopFileServer waits up to 5 seconds for running downloads before closing the server
 func (fs *FileServer) StopFileServer() error {
+	if fs.server == nil {
+		return nil
+	}
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
 	if err := fs.server.Shutdown(ctx); err != nil {
-		log.Error("error in shutting down HTTP server")
+		fs.logger().Errorf("error in shutting down HTTP server: %v", err)
 		return err
 	}
 	return nil
 }
 
+// Run starts the file server,it returns once clair can connect or with the error why it can not
 func (fs *FileServer) Run(ctx context.Context) error {
-	if err := fs.CreateHTTPRootDir(); err != nil {
-		return err
+	if !fs.Streaming {
+		if err := fs.CreateHTTPRootDir(); err != nil {
+			return err
+		}
 	}
 
 	if err := fs.CreateFileServer(); err != nil {
@@ -94,7 +171,8 @@ func (fs *FileServer) Run(ctx context.Context) error {
 	return nil
 }
 
-func (fs *FileServer) SaveFile(digest string,r io.ReadCloser) (string,error) {
+// SaveFile saves a layer to serve,the requests for it are logged with the logger of ctx
+func (fs *FileServer) SaveFile(ctx context.Context,digest string,r io.ReadCloser) (string,error) {
 	fp := filepath.Join(fs.serverRootPath,digest)
 	if _, err := os.Stat(fp); os.IsNotExist(err) {
 		err := os.Mkdir(fp,os.ModePerm)
@@ -104,7 +182,8 @@ func (fs *FileServer) SaveFile(digest string,r io.ReadCloser) (string,error) {
 	}
 
 	fullFilePath := filepath.Join(fp,LayerFileName )
-	log.Infof("save file %s,digest %s,server root path %s,fp %s",fullFilePath,digest,fs.serverRootPath,fp)
+	logger := logging.FromContext(ctx).WithField(logging.FieldLayer,digest)
+	logger.WithField("path",fullFilePath).Info("save file")
 	outFile, err := os.Create(fullFilePath)
 	defer outFile.Close()
 	if err != nil {
@@ -120,17 +199,43 @@ func (fs *FileServer) SaveFile(digest string,r io.ReadCloser) (string,error) {
 	if err != nil {
 		return "",fmt.Errorf("os state layer file err,digest %s,err %v",digest,err)
 	}
+	fs.mu.Lock()
+	fs.loggers[digest] = logger
+	fs.mu.Unlock()
 	return fullFilePath,nil
 }
 
-func (fs *FileServer) DeleteFile(digest string) error {
-	fullFilePath := filepath.Join(fs.serverRootPath,digest,LayerFileName)
-
-	//only delete file,not directory
-	err := os.RemoveAll(fullFilePath)
-	log.Info("remove file %s,err %v",fullFilePath,err)
-	if err != nil {
-		return fmt.Errorf("remove layer file :%s err %v",fullFilePath,err)
+// Cleanup removes the layer directory of this run and resets the fetch counts,
+// call it once the file server is stopped
+func (fs *FileServer) Cleanup() error {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	fs.streams = make(map[string]streamLayer)
+	fs.fetches = make(map[string]LayerFetch)
+	fs.loggers = make(map[string]*log.Entry)
+	if fs.serverRootPath == "" {
+		return nil
 	}
+	if err := os.RemoveAll(fs.serverRootPath); err != nil {
+		fs.logger().Errorf("remove layer dir %s err %v",fs.serverRootPath,err)
+		return err
+	}
+	fs.serverRootPath = ""
 	return nil
-}
\ No newline at end of file
+}
+
+// logger is the logger of the context the file server was created with
+func (fs *FileServer) logger() *log.Entry {
+	return logging.FromContext(fs.ctx)
+}
+
+// layerLogger is the logger of the scan that added the layer,so requests from clair carry its scan id
+func (fs *FileServer) layerLogger(digest string) *log.Entry {
+	fs.mu.Lock()
+	logger,ok := fs.loggers[digest]
+	fs.mu.Unlock()
+	if !ok {
+		logger = fs.logger()
+	}
+	return logger.WithField(logging.FieldLayer,digest)
+}
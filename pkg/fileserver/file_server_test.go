@@ -0,0 +1,93 @@
+package fileserver
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestRunDirs(t *testing.T) {
+	root := t.TempDir()
+	var servers []*FileServer
+	for i := 0; i < 2; i++ {
+		fs, err := NewFileServer(context.Background(), root, "127.0.0.1", "127.0.0.1", 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := fs.CreateHTTPRootDir(); err != nil {
+			t.Fatal(err)
+		}
+		// both runs stage the same base layer
+		if _, err := fs.SaveFile(context.Background(), "sha256:abc", ioutil.NopCloser(strings.NewReader("layer"))); err != nil {
+			t.Fatal(err)
+		}
+		servers = append(servers, fs)
+	}
+	if servers[0].serverRootPath == servers[1].serverRootPath {
+		t.Fatalf("runs share the layer directory %s", servers[0].serverRootPath)
+	}
+
+	if err := servers[0].Cleanup(); err != nil {
+		t.Fatal(err)
+	}
+	entries, err := ioutil.ReadDir(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 || filepath.Join(root, entries[0].Name()) != servers[1].serverRootPath {
+		t.Fatalf("after cleanup of the first run %s has %v,want only %s", root, entries, servers[1].serverRootPath)
+	}
+	data, err := ioutil.ReadFile(filepath.Join(servers[1].serverRootPath, "sha256:abc", LayerFileName))
+	if err != nil || string(data) != "layer" {
+		t.Fatalf("layer of the second run = %q,%v", data, err)
+	}
+
+	if err := servers[1].Cleanup(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(root); err != nil {
+		t.Errorf("cleanup removed the shared parent %s: %v", root, err)
+	}
+}
+
+func TestRunEphemeralPort(t *testing.T) {
+	fs, err := NewFileServer(context.Background(), t.TempDir(), "127.0.0.1", "127.0.0.1", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := fs.Run(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	defer fs.Cleanup()
+	defer fs.StopFileServer()
+	if fs.Port == 0 {
+		t.Fatal("Run returned with port 0")
+	}
+	if _, err := fs.SaveFile(context.Background(), testDigest, ioutil.NopCloser(strings.NewReader("layer"))); err != nil {
+		t.Fatal(err)
+	}
+
+	// the url is advertised while the server still serves,with the port picked by Run
+	u, err := url.Parse(fs.LayerURL(testDigest))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if u.Port() != strconv.Itoa(fs.Port) {
+		t.Fatalf("LayerURL() port = %s,want the listen port %d", u.Port(), fs.Port)
+	}
+	resp, err := http.Get(u.String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	data, err := ioutil.ReadAll(resp.Body)
+	if resp.StatusCode != http.StatusOK || err != nil || string(data) != "layer" {
+		t.Errorf("GET %s = %d %q,%v", u, resp.StatusCode, data, err)
+	}
+}
@@ -0,0 +1,131 @@
+package fileserver
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// DefaultLayerURLTTL is how long a layer url handed to clair stays valid.
+	// Clair downloads the layer while handling the POST,so this only needs to cover slow downloads.
+	DefaultLayerURLTTL = 30 * time.Minute
+
+	signatureKeySize = 32
+	queryExpires     = "expires"
+	querySignature   = "signature"
+)
+
+func newSigningKey() ([]byte, error) {
+	key := make([]byte, signatureKeySize)
+	if _, err := rand.Read(key); err != nil {
+		return nil, fmt.Errorf("generate url signing key err %v", err)
+	}
+	return key, nil
+}
+
+func (fs *FileServer) sign(digest string, expires int64) string {
+	mac := hmac.New(sha256.New, fs.signingKey)
+	fmt.Fprintf(mac, "%s\n%d", digest, expires)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// LayerPath returns the signed path of a saved layer,valid for fs.URLTTL
+func (fs *FileServer) LayerPath(digest string) string {
+	expires := time.Now().Add(fs.URLTTL).Unix()
+	q := url.Values{}
+	q.Set(queryExpires, strconv.FormatInt(expires, 10))
+	q.Set(querySignature, fs.sign(digest, expires))
+	return fmt.Sprintf("/%s/%s?%s", digest, LayerFileName, q.Encode())
+}
+
+// BaseURL is the address clair reaches the file server at,like http://10.0.0.5:5566
+func (fs *FileServer) BaseURL() string {
+	port := fs.Port
+	if fs.ExternalPort != 0 {
+		port = fs.ExternalPort
+	}
+	return fmt.Sprintf("%s://%s", fs.scheme(), net.JoinHostPort(fs.ExternalIp, strconv.Itoa(port)))
+}
+
+// LayerURL returns the signed url clair uses to download a saved layer
+func (fs *FileServer) LayerURL(digest string) string {
+	return fs.BaseURL() + fs.LayerPath(digest)
+}
+
+// verifyLayerRequest checks the path is /<digest>/layer.tar with a valid,unexpired signature
+// and returns the digest
+func (fs *FileServer) verifyLayerRequest(r *http.Request) (string, int, error) {
+	parts := strings.Split(strings.TrimPrefix(r.URL.Path, "/"), "/")
+	if len(parts) != 2 || parts[1] != LayerFileName || parts[0] == "" || strings.Contains(parts[0], "..") {
+		return "", http.StatusNotFound, fmt.Errorf("invalid layer path %s", r.URL.Path)
+	}
+	digest := parts[0]
+
+	q := r.URL.Query()
+	expires, err := strconv.ParseInt(q.Get(queryExpires), 10, 64)
+	if err != nil {
+		return "", http.StatusForbidden, fmt.Errorf("missing or invalid expires")
+	}
+	sig, err := hex.DecodeString(q.Get(querySignature))
+	if err != nil || len(sig) == 0 {
+		return "", http.StatusForbidden, fmt.Errorf("missing or invalid signature")
+	}
+	expected, _ := hex.DecodeString(fs.sign(digest, expires))
+	if !hmac.Equal(sig, expected) {
+		return "", http.StatusForbidden, fmt.Errorf("signature mismatch")
+	}
+	if time.Now().Unix() > expires {
+		return "", http.StatusForbidden, fmt.Errorf("url expired at %s", time.Unix(expires, 0))
+	}
+	return digest, http.StatusOK, nil
+}
+
+// serveLayer serves a single saved layer file for a signed request.
+// There is no directory listing and nothing else under the root dir is reachable.
+func (fs *FileServer) serveLayer(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+		return
+	}
+	digest, code, err := fs.verifyLayerRequest(r)
+	if err != nil {
+		fs.logger().WithField("client", r.RemoteAddr).Warnf("reject layer request %s: %v", r.URL.Path, err)
+		http.Error(w, http.StatusText(code), code)
+		return
+	}
+
+	if l, ok := fs.getStreamLayer(digest); ok {
+		fs.serveStreamLayer(w, r, digest, l)
+		return
+	}
+	if fs.Streaming {
+		fs.layerLogger(digest).WithField("client", r.RemoteAddr).Warn("requested layer is not streamed")
+		http.NotFound(w, r)
+		return
+	}
+
+	f, err := os.Open(filepath.Join(fs.serverRootPath, digest, LayerFileName))
+	if err != nil {
+		fs.layerLogger(digest).WithField("client", r.RemoteAddr).Warnf("open layer err %v", err)
+		http.NotFound(w, r)
+		return
+	}
+	defer f.Close()
+	fi, err := f.Stat()
+	if err != nil {
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+	http.ServeContent(w, r, LayerFileName, fi.ModTime(), f)
+}
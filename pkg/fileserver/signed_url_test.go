@@ -0,0 +1,109 @@
+package fileserver
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+const testDigest = "sha256:0123456789abcdef0123456789abcdef0123456789abcdef0123456789abcdef"
+
+func newTestFileServer(t *testing.T) *FileServer {
+	t.Helper()
+	fs, err := NewFileServer(context.Background(), "", "10.0.0.5", "", 5566)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return fs
+}
+
+func TestVerifyLayerRequest(t *testing.T) {
+	fs := newTestFileServer(t)
+	other := newTestFileServer(t)
+	valid := fs.LayerPath(testDigest)
+	query := valid[strings.IndexByte(valid, '?'):]
+	withQuery := func(p string, set func(q url.Values)) string {
+		u, err := url.Parse(p)
+		if err != nil {
+			t.Fatal(err)
+		}
+		q := u.Query()
+		set(q)
+		u.RawQuery = q.Encode()
+		return u.String()
+	}
+	expired := time.Now().Add(-time.Minute).Unix()
+
+	tests := []struct {
+		name     string
+		path     string
+		wantCode int
+	}{
+		{"valid", valid, http.StatusOK},
+		{"other digest", "/sha256:aaaa/layer.tar" + query, http.StatusForbidden},
+		{"signed by another server", other.LayerPath(testDigest), http.StatusForbidden},
+		{"no signature", "/" + testDigest + "/layer.tar", http.StatusForbidden},
+		{"bad signature", withQuery(valid, func(q url.Values) { q.Set(querySignature, "00ff") }), http.StatusForbidden},
+		{"signature not hex", withQuery(valid, func(q url.Values) { q.Set(querySignature, "zz") }), http.StatusForbidden},
+		{"extended expiry", withQuery(valid, func(q url.Values) { q.Set(queryExpires, strconv.FormatInt(time.Now().Add(time.Hour*24).Unix(), 10)) }), http.StatusForbidden},
+		{"expired", withQuery(valid, func(q url.Values) {
+			q.Set(queryExpires, strconv.FormatInt(expired, 10))
+			q.Set(querySignature, fs.sign(testDigest, expired))
+		}), http.StatusForbidden},
+		{"other file", "/" + testDigest + "/json" + query, http.StatusNotFound},
+		{"parent dir", "/../layer.tar" + query, http.StatusNotFound},
+		{"root", "/", http.StatusNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, tt.path, nil)
+			digest, code, err := fs.verifyLayerRequest(r)
+			if code != tt.wantCode {
+				t.Fatalf("verifyLayerRequest(%s) = %d,%v,want %d", tt.path, code, err, tt.wantCode)
+			}
+			if code == http.StatusOK && digest != testDigest {
+				t.Errorf("digest = %s,want %s", digest, testDigest)
+			}
+		})
+	}
+}
+
+func TestLayerURL(t *testing.T) {
+	tests := []struct {
+		name         string
+		externalIp   string
+		port         int
+		externalPort int
+		want         string
+	}{
+		{"listen port", "10.0.0.5", 5566, 0, "http://10.0.0.5:5566/"},
+		{"external port", "10.0.0.5", 5566, 8080, "http://10.0.0.5:8080/"},
+		{"hostname", "scanner.local", 5566, 0, "http://scanner.local:5566/"},
+		{"ipv6", "fd00::5", 5566, 0, "http://[fd00::5]:5566/"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fs := newTestFileServer(t)
+			fs.ExternalIp, fs.Port, fs.ExternalPort = tt.externalIp, tt.port, tt.externalPort
+			u, err := url.Parse(fs.LayerURL(testDigest))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := u.Scheme + "://" + u.Host + "/"; got != tt.want {
+				t.Errorf("LayerURL() base = %s,want %s", got, tt.want)
+			}
+			if u.Path != "/"+testDigest+"/"+LayerFileName {
+				t.Errorf("LayerURL() path = %s", u.Path)
+			}
+			r := httptest.NewRequest(http.MethodGet, u.RequestURI(), nil)
+			if _, code, err := fs.verifyLayerRequest(r); code != http.StatusOK {
+				t.Errorf("the url does not verify: %d,%v", code, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,121 @@
+package fileserver
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+
+	"github.com/opencontainers/go-digest"
+	"github.com/wadeling/clair-client/pkg/logging"
+)
+
+// LayerOpener opens the content of a streamed layer,e.g. downloads the blob from the registry
+type LayerOpener func(ctx context.Context) (io.ReadCloser, error)
+
+// streamLayer is served from its source on every request instead of from disk
+type streamLayer struct {
+	size int64 //-1 if unknown
+	open LayerOpener
+}
+
+// AddStreamLayer serves the layer by streaming it from open when clair requests it,
+// nothing is written to disk. The content is verified against the digest while it is sent
+// and the last bytes are held back until it matches; on a mismatch the connection is aborted
+// before the layer is complete.
+// open gets the request context carrying the logger of ctx.
+func (fs *FileServer) AddStreamLayer(ctx context.Context, dg string, size int64, open LayerOpener) error {
+	if _, err := digest.Parse(dg); err != nil {
+		return fmt.Errorf("invalid layer digest %s: %v", dg, err)
+	}
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	fs.streams[dg] = streamLayer{size: size, open: open}
+	fs.loggers[dg] = logging.FromContext(ctx)
+	return nil
+}
+
+func (fs *FileServer) getStreamLayer(dg string) (streamLayer, bool) {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	l, ok := fs.streams[dg]
+	return l, ok
+}
+
+func (fs *FileServer) serveStreamLayer(w http.ResponseWriter, r *http.Request, dg string, l streamLayer) {
+	if l.size >= 0 {
+		w.Header().Set("Content-Length", strconv.FormatInt(l.size, 10))
+	}
+	w.Header().Set("Content-Type", "application/x-tar")
+	if r.Method == http.MethodHead {
+		return
+	}
+
+	logger := fs.layerLogger(dg).WithField("client", r.RemoteAddr)
+	rc, err := l.open(logging.WithLogger(r.Context(), logger))
+	if err != nil {
+		logger.Errorf("open stream layer err %v", err)
+		http.Error(w, http.StatusText(http.StatusBadGateway), http.StatusBadGateway)
+		return
+	}
+	defer rc.Close()
+
+	verifier := digest.Digest(dg).Verifier()
+	// the end of the layer is only sent once the digest is verified,
+	// on a mismatch clair gets a short body and fails the download instead of scanning wrong content
+	tw := &tailWriter{w: w, tail: make([]byte, 0, streamHoldBack)}
+	n, err := io.Copy(tw, io.TeeReader(rc, verifier))
+	if err != nil {
+		logger.Errorf("stream layer err %v after %d bytes", err, n)
+		panic(http.ErrAbortHandler)
+	}
+	if !verifier.Verified() {
+		logger.Error("stream layer: content does not match the digest")
+		panic(http.ErrAbortHandler)
+	}
+	if err := tw.Flush(); err != nil {
+		logger.Errorf("stream layer err %v after %d bytes", err, n)
+		return
+	}
+	logger.WithField("bytes", n).Info("streamed layer")
+}
+
+// streamHoldBack is how many bytes of a streamed layer are held back until its digest is verified
+const streamHoldBack = 32 * 1024
+
+// tailWriter writes all but the last cap(tail) bytes,Flush writes those
+type tailWriter struct {
+	w    io.Writer
+	tail []byte
+}
+
+func (t *tailWriter) Write(p []byte) (int, error) {
+	n := len(p)
+	if over := len(t.tail) + len(p) - cap(t.tail); over > 0 {
+		// send the oldest over bytes,first from the tail then from p
+		fromTail := over
+		if fromTail > len(t.tail) {
+			fromTail = len(t.tail)
+		}
+		if _, err := t.w.Write(t.tail[:fromTail]); err != nil {
+			return 0, err
+		}
+		t.tail = t.tail[:copy(t.tail, t.tail[fromTail:])]
+		if fromP := over - fromTail; fromP > 0 {
+			if _, err := t.w.Write(p[:fromP]); err != nil {
+				return 0, err
+			}
+			p = p[fromP:]
+		}
+	}
+	t.tail = append(t.tail, p...)
+	return n, nil
+}
+
+// Flush writes the held back bytes
+func (t *tailWriter) Flush() error {
+	_, err := t.w.Write(t.tail)
+	t.tail = t.tail[:0]
+	return err
+}
@@ -0,0 +1,97 @@
+package fileserver
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/opencontainers/go-digest"
+)
+
+func TestTailWriter(t *testing.T) {
+	data := bytes.Repeat([]byte("0123456789"), 10)
+	tests := []struct {
+		name   string
+		hold   int
+		writes []int
+	}{
+		{"single write", 8, []int{100}},
+		{"small writes", 8, []int{3, 3, 3, 3, 88}},
+		{"writes larger than the tail", 8, []int{20, 30, 50}},
+		{"shorter than the tail", 200, []int{40, 60}},
+		{"exact tail", 100, []int{100}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var out bytes.Buffer
+			tw := &tailWriter{w: &out, tail: make([]byte, 0, tt.hold)}
+			off := 0
+			for _, n := range tt.writes {
+				if w, err := tw.Write(data[off : off+n]); err != nil || w != n {
+					t.Fatalf("Write() = %d,%v", w, err)
+				}
+				off += n
+			}
+			wantSent := len(data) - tt.hold
+			if wantSent < 0 {
+				wantSent = 0
+			}
+			if !bytes.Equal(out.Bytes(), data[:wantSent]) {
+				t.Fatalf("before Flush sent %q,want %q", out.Bytes(), data[:wantSent])
+			}
+			if err := tw.Flush(); err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(out.Bytes(), data) {
+				t.Errorf("after Flush sent %q,want %q", out.Bytes(), data)
+			}
+		})
+	}
+}
+
+func TestServeStreamLayerVerifiesBeforeTheEnd(t *testing.T) {
+	content := bytes.Repeat([]byte("layer"), 20000)
+	tests := []struct {
+		name     string
+		digest   digest.Digest
+		wantBody bool
+	}{
+		{"match", digest.FromBytes(content), true},
+		{"mismatch", digest.FromString("other"), false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fs, err := NewFileServer(context.Background(), "", "127.0.0.1", "127.0.0.1", 0)
+			if err != nil {
+				t.Fatal(err)
+			}
+			l := streamLayer{size: int64(len(content)), open: func(context.Context) (io.ReadCloser, error) {
+				return ioutil.NopCloser(bytes.NewReader(content)), nil
+			}}
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				fs.serveStreamLayer(w, r, tt.digest.String(), l)
+			}))
+			defer srv.Close()
+
+			resp, err := http.Get(srv.URL)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer resp.Body.Close()
+			body, err := ioutil.ReadAll(resp.Body)
+			if tt.wantBody {
+				if err != nil || !bytes.Equal(body, content) {
+					t.Errorf("got %d bytes,%v,want the whole layer", len(body), err)
+				}
+				return
+			}
+			if err == nil || len(body) > len(content)-streamHoldBack {
+				t.Errorf("got %d bytes,%v,want an error before the last %d bytes", len(body), err, streamHoldBack)
+			}
+		})
+	}
+}
@@ -0,0 +1,198 @@
+package fileserver
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"fmt"
+	"io/ioutil"
+	"math/big"
+	"net"
+	"os"
+	"time"
+)
+
+const (
+	DefaultCAFile    = "clair-client-ca.pem"
+	DefaultCAKeyFile = "clair-client-ca-key.pem"
+
+	// selfSignedValidity of the server cert issued per run
+	selfSignedValidity = 24 * time.Hour
+	// caValidity of a CA that is kept for later runs
+	caValidity = 5 * 365 * 24 * time.Hour
+)
+
+// EnableTLS serves layers over https with the given certificate and key
+func (fs *FileServer) EnableTLS(certFile, keyFile string) error {
+	cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+	if err != nil {
+		return fmt.Errorf("load file server cert %s,key %s err %v", certFile, keyFile, err)
+	}
+	fs.tlsConfig = &tls.Config{
+		Certificates: []tls.Certificate{cert},
+		MinVersion:   tls.VersionTLS12,
+	}
+	return nil
+}
+
+// EnableSelfSignedTLS serves layers over https with a certificate for ExternalIp issued by
+// a local CA. The CA certificate is written to caFile and its key to caKeyFile,clair must trust
+// the CA (e.g. mount it into /usr/local/share/ca-certificates of the clair container).
+// An existing CA in caFile and caKeyFile is reused,so clair keeps trusting it across runs;
+// only the server certificate is issued per run. Empty caKeyFile uses a new CA every run.
+func (fs *FileServer) EnableSelfSignedTLS(caFile, caKeyFile string) error {
+	caCert, caKey, err := loadCA(caFile, caKeyFile)
+	if err != nil {
+		return err
+	}
+	if caCert == nil {
+		if caCert, caKey, err = newCA(caFile, caKeyFile); err != nil {
+			return err
+		}
+		fs.logger().Infof("file server created ca,cert written to %s", caFile)
+	} else {
+		fs.logger().Infof("file server reuse ca %s", caFile)
+	}
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return fmt.Errorf("generate server key err %v", err)
+	}
+	now := time.Now()
+	template := &x509.Certificate{
+		SerialNumber: newSerial(),
+		Subject:      pkix.Name{CommonName: fs.ExternalIp},
+		NotBefore:    now.Add(-time.Hour),
+		NotAfter:     now.Add(selfSignedValidity),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}
+	if ip := net.ParseIP(fs.ExternalIp); ip != nil {
+		template.IPAddresses = []net.IP{ip}
+	} else {
+		template.DNSNames = []string{fs.ExternalIp}
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, caCert, &key.PublicKey, caKey)
+	if err != nil {
+		return fmt.Errorf("create server cert err %v", err)
+	}
+	fs.logger().Infof("file server use self signed cert for %s", fs.ExternalIp)
+
+	fs.tlsConfig = &tls.Config{
+		Certificates: []tls.Certificate{{
+			Certificate: [][]byte{der, caCert.Raw},
+			PrivateKey:  key,
+		}},
+		MinVersion: tls.VersionTLS12,
+	}
+	return nil
+}
+
+// loadCA reads the CA of a previous run,nil if there is none or it expires soon
+func loadCA(caFile, caKeyFile string) (*x509.Certificate, *ecdsa.PrivateKey, error) {
+	if caKeyFile == "" {
+		return nil, nil, nil
+	}
+	certPEM, err := ioutil.ReadFile(caFile)
+	if os.IsNotExist(err) {
+		return nil, nil, nil
+	}
+	if err != nil {
+		return nil, nil, fmt.Errorf("read ca cert %s err %v", caFile, err)
+	}
+	keyPEM, err := ioutil.ReadFile(caKeyFile)
+	if os.IsNotExist(err) {
+		return nil, nil, nil
+	}
+	if err != nil {
+		return nil, nil, fmt.Errorf("read ca key %s err %v", caKeyFile, err)
+	}
+
+	certBlock, _ := pem.Decode(certPEM)
+	keyBlock, _ := pem.Decode(keyPEM)
+	if certBlock == nil || keyBlock == nil {
+		return nil, nil, fmt.Errorf("ca cert %s or key %s is not pem", caFile, caKeyFile)
+	}
+	caCert, err := x509.ParseCertificate(certBlock.Bytes)
+	if err != nil {
+		return nil, nil, fmt.Errorf("parse ca cert %s err %v", caFile, err)
+	}
+	caKey, err := x509.ParseECPrivateKey(keyBlock.Bytes)
+	if err != nil {
+		return nil, nil, fmt.Errorf("parse ca key %s err %v", caKeyFile, err)
+	}
+	if !caKey.PublicKey.Equal(caCert.PublicKey) {
+		return nil, nil, fmt.Errorf("ca key %s does not match ca cert %s", caKeyFile, caFile)
+	}
+	if time.Now().Add(selfSignedValidity).After(caCert.NotAfter) {
+		// the server cert must not outlive its CA
+		return nil, nil, nil
+	}
+	return caCert, caKey, nil
+}
+
+// newCA creates a CA and writes it to caFile and,unless empty,caKeyFile
+func newCA(caFile, caKeyFile string) (*x509.Certificate, *ecdsa.PrivateKey, error) {
+	caKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, nil, fmt.Errorf("generate ca key err %v", err)
+	}
+	now := time.Now()
+	validity := caValidity
+	if caKeyFile == "" {
+		validity = selfSignedValidity
+	}
+	caTemplate := &x509.Certificate{
+		SerialNumber:          newSerial(),
+		Subject:               pkix.Name{CommonName: "clair-client layer server CA"},
+		NotBefore:             now.Add(-time.Hour),
+		NotAfter:              now.Add(validity),
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageDigitalSignature,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+		MaxPathLenZero:        true,
+	}
+	caDER, err := x509.CreateCertificate(rand.Reader, caTemplate, caTemplate, &caKey.PublicKey, caKey)
+	if err != nil {
+		return nil, nil, fmt.Errorf("create ca cert err %v", err)
+	}
+	caCert, err := x509.ParseCertificate(caDER)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if caKeyFile != "" {
+		keyDER, err := x509.MarshalECPrivateKey(caKey)
+		if err != nil {
+			return nil, nil, err
+		}
+		keyPEM := pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER})
+		if err := ioutil.WriteFile(caKeyFile, keyPEM, 0600); err != nil {
+			return nil, nil, fmt.Errorf("write ca key %s err %v", caKeyFile, err)
+		}
+	}
+	caPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: caDER})
+	if err := ioutil.WriteFile(caFile, caPEM, 0644); err != nil {
+		return nil, nil, fmt.Errorf("write ca cert %s err %v", caFile, err)
+	}
+	return caCert, caKey, nil
+}
+
+func (fs *FileServer) scheme() string {
+	if fs.tlsConfig != nil {
+		return "https"
+	}
+	return "http"
+}
+
+func newSerial() *big.Int {
+	serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	if err != nil {
+		return big.NewInt(time.Now().UnixNano())
+	}
+	return serial
+}
@@ -0,0 +1,64 @@
+package fileserver
+
+import (
+	"bytes"
+	"context"
+	"crypto/x509"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestSelfSignedTLSReusesCA(t *testing.T) {
+	dir := t.TempDir()
+	caFile := filepath.Join(dir, DefaultCAFile)
+	caKeyFile := filepath.Join(dir, DefaultCAKeyFile)
+
+	issue := func(caKeyFile string) (ca, leaf []byte) {
+		fs, err := NewFileServer(context.Background(), "", "10.0.0.5", "", 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := fs.EnableSelfSignedTLS(caFile, caKeyFile); err != nil {
+			t.Fatal(err)
+		}
+		chain := fs.tlsConfig.Certificates[0].Certificate
+		return chain[1], chain[0]
+	}
+
+	ca1, leaf1 := issue(caKeyFile)
+	if fi, err := os.Stat(caKeyFile); err != nil || fi.Mode().Perm() != 0600 {
+		t.Fatalf("ca key %s: %v,%v", caKeyFile, fi, err)
+	}
+	ca2, leaf2 := issue(caKeyFile)
+	if !bytes.Equal(ca1, ca2) {
+		t.Error("second run created a new ca")
+	}
+	if bytes.Equal(leaf1, leaf2) {
+		t.Error("second run reused the server cert")
+	}
+
+	caCert, err := x509.ParseCertificate(ca2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	leaf, err := x509.ParseCertificate(leaf2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pool := x509.NewCertPool()
+	pool.AddCert(caCert)
+	if _, err := leaf.Verify(x509.VerifyOptions{Roots: pool}); err != nil {
+		t.Errorf("server cert does not verify with the reused ca: %v", err)
+	}
+	written, err := ioutil.ReadFile(caFile)
+	if err != nil || !bytes.Contains(written, []byte("CERTIFICATE")) {
+		t.Errorf("ca file %s = %q,%v", caFile, written, err)
+	}
+
+	ca3, _ := issue("")
+	if bytes.Equal(ca1, ca3) {
+		t.Error("run without a ca key reused the ca")
+	}
+}
@@ -0,0 +1,81 @@
+package logging
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"strings"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// field names used in the log lines of a scan
+const (
+	FieldScanID     = "scan_id"
+	FieldImage      = "image"
+	FieldDigest     = "digest"
+	FieldLayer      = "layer"
+	FieldLayerIndex = "layer_index"
+)
+
+// log formats
+const (
+	FormatText = "text"
+	FormatJSON = "json"
+)
+
+// Formats are the supported log formats
+var Formats = []string{FormatText, FormatJSON}
+
+type loggerKey struct{}
+
+// Setup configures the standard logger,format is text or json and level a logrus level like debug or info.
+// Empty values keep the logrus defaults.
+func Setup(format, level string) error {
+	switch format {
+	case "", FormatText:
+		log.SetFormatter(&log.TextFormatter{})
+	case FormatJSON:
+		log.SetFormatter(&log.JSONFormatter{})
+	default:
+		return fmt.Errorf("log format %s is not one of %s", format, strings.Join(Formats, ","))
+	}
+	if level != "" {
+		lvl, err := log.ParseLevel(level)
+		if err != nil {
+			return err
+		}
+		log.SetLevel(lvl)
+	}
+	return nil
+}
+
+// WithLogger returns a copy of ctx carrying logger
+func WithLogger(ctx context.Context, logger *log.Entry) context.Context {
+	return context.WithValue(ctx, loggerKey{}, logger)
+}
+
+// FromContext returns the logger of ctx,the standard logger if there is none
+func FromContext(ctx context.Context) *log.Entry {
+	if ctx != nil {
+		if logger, ok := ctx.Value(loggerKey{}).(*log.Entry); ok {
+			return logger
+		}
+	}
+	return log.NewEntry(log.StandardLogger())
+}
+
+// WithFields returns a copy of ctx whose logger adds fields to every line
+func WithFields(ctx context.Context, fields log.Fields) context.Context {
+	return WithLogger(ctx, FromContext(ctx).WithFields(fields))
+}
+
+// NewScanID returns a random id to tell the log lines of concurrent scans apart
+func NewScanID() string {
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		return "unknown"
+	}
+	return hex.EncodeToString(b)
+}
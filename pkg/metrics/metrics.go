@@ -0,0 +1,112 @@
+package metrics
+
+import (
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+const namespace = "clair_client"
+
+var (
+	LayerDownloadBytes = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "layer_download_bytes_total",
+		Help:      "Bytes of layers downloaded from the registry.",
+	})
+	LayerDownloadDuration = prometheus.NewHistogram(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "layer_download_duration_seconds",
+		Help:      "Time to download a layer from the registry,until it is read completely.",
+		Buckets:   prometheus.ExponentialBuckets(0.1, 2, 12),
+	})
+	ClairRequestDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "clair_request_duration_seconds",
+		Help:      "Latency of clair requests by endpoint and status code,code is \"error\" without a response.",
+		Buckets:   prometheus.ExponentialBuckets(0.01, 2, 15),
+	}, []string{"endpoint", "code"})
+	ScansInFlight = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "scans_in_flight",
+		Help:      "Scans currently running.",
+	})
+	Vulnerabilities = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "vulnerabilities_total",
+		Help:      "Vulnerabilities found by severity.",
+	}, []string{"severity"})
+	CacheRequests = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "cache_requests_total",
+		Help:      "Cache lookups by cache and result (hit or miss): clair_result is an image already scanned by clair,registry_token a cached registry token.",
+	}, []string{"cache", "result"})
+)
+
+// Registry holds the clair-client metrics and the go runtime and process metrics
+var Registry = prometheus.NewRegistry()
+
+func init() {
+	Registry.MustRegister(
+		prometheus.NewGoCollector(),
+		prometheus.NewProcessCollector(prometheus.ProcessCollectorOpts{}),
+		LayerDownloadBytes,
+		LayerDownloadDuration,
+		ClairRequestDuration,
+		ScansInFlight,
+		Vulnerabilities,
+		CacheRequests,
+	)
+}
+
+// Handler serves the metrics for /metrics
+func Handler() http.Handler {
+	return promhttp.HandlerFor(Registry, promhttp.HandlerOpts{})
+}
+
+func CacheHit(cache string) {
+	CacheRequests.WithLabelValues(cache, "hit").Inc()
+}
+
+func CacheMiss(cache string) {
+	CacheRequests.WithLabelValues(cache, "miss").Inc()
+}
+
+// ObserveClairRequest records a clair request,code 0 means there was no response
+func ObserveClairRequest(endpoint string, code int, d time.Duration) {
+	c := "error"
+	if code != 0 {
+		c = strconv.Itoa(code)
+	}
+	ClairRequestDuration.WithLabelValues(endpoint, c).Observe(d.Seconds())
+}
+
+// InstrumentDownload counts the bytes read from a layer download and observes
+// its duration when it is closed
+func InstrumentDownload(rc io.ReadCloser) io.ReadCloser {
+	return &downloadReader{ReadCloser: rc, start: time.Now()}
+}
+
+type downloadReader struct {
+	io.ReadCloser
+	start  time.Time
+	closed bool
+}
+
+func (r *downloadReader) Read(p []byte) (int, error) {
+	n, err := r.ReadCloser.Read(p)
+	LayerDownloadBytes.Add(float64(n))
+	return n, err
+}
+
+func (r *downloadReader) Close() error {
+	if !r.closed {
+		r.closed = true
+		LayerDownloadDuration.Observe(time.Since(r.start).Seconds())
+	}
+	return r.ReadCloser.Close()
+}
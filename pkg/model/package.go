@@ -0,0 +1,13 @@
+package model
+
+// Package is a feature clair found in an image,vulnerable or not
+type Package struct {
+	Name          string `json:"name" bson:"name"`
+	Version       string `json:"version" bson:"version"`
+	VersionFormat string `json:"versionformat" bson:"versionformat"`
+	Namespace     string `json:"namespace" bson:"namespace"`
+	// AddedBy is the layer that installed the package
+	AddedBy string `json:"addedby" bson:"addedby"`
+	// Vulnerabilities is the number of vulnerabilities of the package
+	Vulnerabilities int `json:"vulnerabilities" bson:"vulnerabilities"`
+}
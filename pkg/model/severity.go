@@ -0,0 +1,16 @@
+package model
+
+import "strings"
+
+// Severities are the clair severities from lowest to highest
+var Severities = []string{"Unknown", "Negligible", "Low", "Medium", "High", "Critical", "Defcon1"}
+
+// SeverityRank returns the position of severity in Severities (case insensitive),-1 if unknown
+func SeverityRank(severity string) int {
+	for i, s := range Severities {
+		if strings.EqualFold(s, severity) {
+			return i
+		}
+	}
+	return -1
+}
@@ -37,5 +37,35 @@ type VulnerabilityInfo struct {
 	CVSS   CVSSVulnerabilityInfo    `json:"cvss,omitempty" bson:"cvss,omitempty"`
 	CNNVDs []CNNVDVulnerabilityInfo `json:"cnnvds,omitempty" bson:"cnnvds,omitempty"`
 	CNVDs  []CNVDVulnerabilityInfo  `json:"cnvds,omitempty" bson:"cnvds,omitempty"`
+
+	// Packages are all packages with this vulnerability when the result is grouped by id,
+	// FeatureName,FeatureVersion and FixedBy are those of the first one then
+	Packages []AffectedPackage `json:"packages,omitempty" bson:"packages,omitempty"`
+}
+
+// AffectedPackage is a package a vulnerability is found in
+type AffectedPackage struct {
+	FeatureName    string `json:"featurename" bson:"featurename"`
+	FeatureVersion string `json:"featureversion" bson:"featureversion"`
+	FixedBy        string `json:"fixedby" bson:"fixedby"`
+}
+
+// VulnerabilityKey identifies a vulnerability of one package version,
+// the same CVE in two packages (e.g. openssl and libssl1.1) are two results
+type VulnerabilityKey struct {
+	ID             string
+	FeatureName    string
+	FeatureVersion string
+}
+
+func (v VulnerabilityInfo) Key() VulnerabilityKey {
+	return VulnerabilityKey{ID: v.ID, FeatureName: v.FeatureName, FeatureVersion: v.FeatureVersion}
 }
 
+// AffectedPackages returns Packages,or the package of v if it is not grouped
+func (v VulnerabilityInfo) AffectedPackages() []AffectedPackage {
+	if len(v.Packages) > 0 {
+		return v.Packages
+	}
+	return []AffectedPackage{{FeatureName: v.FeatureName, FeatureVersion: v.FeatureVersion, FixedBy: v.FixedBy}}
+}
@@ -0,0 +1,107 @@
+package progress
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	barWidth = 30
+	// redraw at most this often,downloads report every read
+	barRedrawInterval = 100 * time.Millisecond
+)
+
+// bar redraws a single terminal line
+type bar struct {
+	state
+	out      io.Writer
+	lastDraw time.Time
+	drawn    bool
+	// logger writes to out too,its lines are moved above the bar until Done
+	logger *log.Logger
+}
+
+// newBar draws a progress bar on out,which should be a terminal
+func newBar(out io.Writer, logger *log.Logger) *bar {
+	b := &bar{out: out}
+	if logger.Out == out {
+		b.logger = logger
+	}
+	return b
+}
+
+// Start and Done swap the logger output without holding b.mu,
+// a logging goroutine holds the logger lock while logWriter takes b.mu
+func (b *bar) Start(layers int, total int64) {
+	b.mu.Lock()
+	b.begin(layers, total)
+	b.draw(true)
+	b.mu.Unlock()
+	if b.logger != nil {
+		b.logger.SetOutput(logWriter{b})
+	}
+}
+
+func (b *bar) Downloaded(n int64) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.downloaded += n
+	b.draw(false)
+}
+
+func (b *bar) Posted(index int, err error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.post(err)
+	b.draw(true)
+}
+
+func (b *bar) Done() {
+	if b.logger != nil {
+		b.logger.SetOutput(b.out)
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.draw(true)
+	fmt.Fprintln(b.out)
+	b.drawn = false
+}
+
+// clear erases the bar,the cursor is at the start of the line then
+func (b *bar) clear() {
+	if b.drawn {
+		fmt.Fprint(b.out, "\r\033[K")
+		b.drawn = false
+	}
+}
+
+func (b *bar) draw(force bool) {
+	if !force && time.Since(b.lastDraw) < barRedrawInterval {
+		return
+	}
+	b.lastDraw = time.Now()
+	b.drawn = true
+	f := b.fraction()
+	filled := int(f * barWidth)
+	fmt.Fprintf(b.out, "\r\033[K[%s%s] %3.0f%% %s %v",
+		strings.Repeat("=", filled), strings.Repeat(" ", barWidth-filled), f*100,
+		b.summary(), time.Since(b.start).Round(time.Second))
+}
+
+// logWriter prints log lines above the bar
+type logWriter struct {
+	b *bar
+}
+
+func (w logWriter) Write(p []byte) (int, error) {
+	w.b.mu.Lock()
+	defer w.b.mu.Unlock()
+	w.b.clear()
+	n, err := w.b.out.Write(p)
+	w.b.draw(true)
+	return n, err
+}
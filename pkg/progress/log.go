@@ -0,0 +1,74 @@
+package progress
+
+import (
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// logReporter writes a progress line every interval,for logs that are not a terminal
+type logReporter struct {
+	state
+	logger   *log.Entry
+	interval time.Duration
+	stop     chan struct{}
+	wg       sync.WaitGroup
+}
+
+// NewLog logs the progress to logger every interval
+func NewLog(logger *log.Entry, interval time.Duration) Reporter {
+	return &logReporter{logger: logger, interval: interval, stop: make(chan struct{})}
+}
+
+func (l *logReporter) Start(layers int, total int64) {
+	l.mu.Lock()
+	l.begin(layers, total)
+	l.mu.Unlock()
+
+	l.wg.Add(1)
+	go func() {
+		defer l.wg.Done()
+		ticker := time.NewTicker(l.interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-l.stop:
+				return
+			case <-ticker.C:
+				l.log("scan progress")
+			}
+		}
+	}()
+}
+
+func (l *logReporter) Downloaded(n int64) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.downloaded += n
+}
+
+func (l *logReporter) Posted(index int, err error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.post(err)
+}
+
+func (l *logReporter) Done() {
+	close(l.stop)
+	l.wg.Wait()
+	l.log("scan progress done")
+}
+
+func (l *logReporter) log(msg string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.logger.WithFields(log.Fields{
+		"downloaded_bytes": l.downloaded,
+		"total_bytes":      l.total,
+		"posted_layers":    l.posted,
+		"failed_layers":    l.failed,
+		"layers":           l.layers,
+		"elapsed":          time.Since(l.start).Round(time.Second).String(),
+	}).Infof("%s: %3.0f%% %s", msg, l.fraction()*100, l.summary())
+}
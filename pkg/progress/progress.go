@@ -0,0 +1,185 @@
+package progress
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// modes of New
+const (
+	// ModeAuto draws a bar on a terminal and logs otherwise
+	ModeAuto = "auto"
+	ModeBar  = "bar"
+	ModeLog  = "log"
+	ModeNone = "none"
+)
+
+// Modes are the supported progress modes
+var Modes = []string{ModeAuto, ModeBar, ModeLog, ModeNone}
+
+// LogInterval is how often the log reporter writes a progress line
+const LogInterval = 10 * time.Second
+
+// Reporter is told the progress of a scan: the bytes of the layers downloaded from the image source
+// and the layers posted to clair. Streamed layers are downloaded while clair requests them,
+// so implementations must be safe for concurrent use.
+type Reporter interface {
+	// Start announces a scan of layers layers with total bytes to download,
+	// total is -1 if a layer size is unknown and 0 if nothing is downloaded
+	Start(layers int, total int64)
+	// Downloaded adds n downloaded bytes
+	Downloaded(n int64)
+	// Posted reports the layer at index was posted to clair,err is nil on success
+	Posted(index int, err error)
+	// Done ends the report
+	Done()
+}
+
+// New returns the reporter of mode writing a bar to out or log lines to logger.
+// While a bar is drawn the log lines of logger written to out are printed above it.
+// Empty mode and ModeNone report nothing.
+func New(mode string, out *os.File, logger *log.Entry) (Reporter, error) {
+	switch mode {
+	case "", ModeNone:
+		return Nop, nil
+	case ModeAuto:
+		if IsTerminal(out) {
+			return newBar(out, logger.Logger), nil
+		}
+		return NewLog(logger, LogInterval), nil
+	case ModeBar:
+		return newBar(out, logger.Logger), nil
+	case ModeLog:
+		return NewLog(logger, LogInterval), nil
+	}
+	return nil, fmt.Errorf("progress mode %s is not one of %s", mode, strings.Join(Modes, ","))
+}
+
+// IsTerminal reports whether f is a character device like a terminal
+func IsTerminal(f *os.File) bool {
+	fi, err := f.Stat()
+	return err == nil && fi.Mode()&os.ModeCharDevice != 0
+}
+
+// Nop discards the progress
+var Nop Reporter = nop{}
+
+type nop struct{}
+
+func (nop) Start(int, int64)  {}
+func (nop) Downloaded(int64)  {}
+func (nop) Posted(int, error) {}
+func (nop) Done()             {}
+
+type reporterKey struct{}
+
+// WithReporter returns a copy of ctx carrying r
+func WithReporter(ctx context.Context, r Reporter) context.Context {
+	return context.WithValue(ctx, reporterKey{}, r)
+}
+
+// FromContext returns the reporter of ctx,Nop if there is none
+func FromContext(ctx context.Context) Reporter {
+	if r, ok := ctx.Value(reporterKey{}).(Reporter); ok {
+		return r
+	}
+	return Nop
+}
+
+// NewReader reports the bytes read from r as downloaded
+func NewReader(r io.ReadCloser, reporter Reporter) io.ReadCloser {
+	return &reader{ReadCloser: r, reporter: reporter}
+}
+
+type reader struct {
+	io.ReadCloser
+	reporter Reporter
+}
+
+func (r *reader) Read(p []byte) (int, error) {
+	n, err := r.ReadCloser.Read(p)
+	if n > 0 {
+		r.reporter.Downloaded(int64(n))
+	}
+	return n, err
+}
+
+// state is the progress shared by the reporters,guarded by mu
+type state struct {
+	mu         sync.Mutex
+	start      time.Time
+	layers     int
+	total      int64
+	downloaded int64
+	posted     int
+	failed     int
+}
+
+func (s *state) begin(layers int, total int64) {
+	s.start = time.Now()
+	s.layers = layers
+	s.total = total
+}
+
+func (s *state) post(err error) {
+	if err != nil {
+		s.failed++
+		return
+	}
+	s.posted++
+}
+
+// fraction is the overall progress from 0 to 1,downloads and posts count half each
+// when the sizes are known
+func (s *state) fraction() float64 {
+	if s.layers == 0 {
+		return 0
+	}
+	posted := float64(s.posted+s.failed) / float64(s.layers)
+	if s.total <= 0 {
+		return posted
+	}
+	downloaded := float64(s.downloaded) / float64(s.total)
+	if downloaded > 1 {
+		downloaded = 1
+	}
+	return (downloaded + posted) / 2
+}
+
+// summary is like "downloaded 12.0MB/40.0MB,posted 2/5 layers",
+// downloads are left out when nothing is downloaded,e.g. clair pulls from the registry
+func (s *state) summary() string {
+	var b strings.Builder
+	if s.total != 0 || s.downloaded > 0 {
+		b.WriteString("downloaded " + formatBytes(s.downloaded))
+		if s.total > 0 {
+			b.WriteString("/" + formatBytes(s.total))
+		}
+		b.WriteString(",")
+	}
+	fmt.Fprintf(&b, "posted %d/%d layers", s.posted, s.layers)
+	if s.failed > 0 {
+		fmt.Fprintf(&b, ",%d failed", s.failed)
+	}
+	return b.String()
+}
+
+func formatBytes(n int64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%dB", n)
+	}
+	div, exp := int64(unit), 0
+	for m := n / unit; m >= unit; m /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f%cB", float64(n)/float64(div), "KMGTPE"[exp])
+}
@@ -0,0 +1,91 @@
+package progress
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+func TestState(t *testing.T) {
+	tests := []struct {
+		name         string
+		layers       int
+		total        int64
+		downloaded   int64
+		posted       int
+		failed       int
+		wantFraction float64
+		wantSummary  string
+	}{
+		{"no layers", 0, 0, 0, 0, 0, 0, "posted 0/0 layers"},
+		{"direct", 4, 0, 0, 1, 0, 0.25, "posted 1/4 layers"},
+		{"failed posts count", 4, 0, 0, 1, 1, 0.5, "posted 1/4 layers,1 failed"},
+		{"sizes unknown", 2, -1, 512, 1, 0, 0.5, "downloaded 512B,posted 1/2 layers"},
+		{"downloads and posts half each", 2, 2048, 1024, 1, 0, 0.5, "downloaded 1.0KB/2.0KB,posted 1/2 layers"},
+		{"downloaded", 2, 3 << 20, 3 << 20, 0, 0, 0.5, "downloaded 3.0MB/3.0MB,posted 0/2 layers"},
+		{"more downloaded than announced", 2, 1000, 1500, 2, 0, 1, "downloaded 1.5KB/1000B,posted 2/2 layers"},
+		{"done", 3, 1536 << 20, 1536 << 20, 2, 1, 1, "downloaded 1.5GB/1.5GB,posted 2/3 layers,1 failed"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := &state{layers: tt.layers, total: tt.total, downloaded: tt.downloaded, posted: tt.posted, failed: tt.failed}
+			if got := s.fraction(); got != tt.wantFraction {
+				t.Errorf("fraction() = %v,want %v", got, tt.wantFraction)
+			}
+			if got := s.summary(); got != tt.wantSummary {
+				t.Errorf("summary() = %q,want %q", got, tt.wantSummary)
+			}
+		})
+	}
+}
+
+func TestLogReporter(t *testing.T) {
+	var buf bytes.Buffer
+	logger := log.New()
+	logger.SetOutput(&buf)
+	logger.SetFormatter(&log.TextFormatter{DisableTimestamp: true})
+
+	// the interval is long enough that only Done logs
+	r := NewLog(log.NewEntry(logger), time.Hour)
+	r.Start(2, 2048)
+	r.Downloaded(1024)
+	r.Downloaded(1024)
+	r.Posted(0, nil)
+	r.Posted(1, errors.New("could not download layer"))
+	r.Done()
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != 1 {
+		t.Fatalf("logged %d lines,want 1:\n%s", len(lines), buf.String())
+	}
+	for _, want := range []string{
+		`msg="scan progress done: 100% downloaded 2.0KB/2.0KB,posted 1/2 layers,1 failed"`,
+		"downloaded_bytes=2048", "total_bytes=2048", "posted_layers=1", "failed_layers=1", "layers=2",
+	} {
+		if !strings.Contains(lines[0], want) {
+			t.Errorf("log line %q misses %s", lines[0], want)
+		}
+	}
+}
+
+func TestLogReporterInterval(t *testing.T) {
+	var buf bytes.Buffer
+	logger := log.New()
+	logger.SetOutput(&buf)
+	r := NewLog(log.NewEntry(logger), time.Millisecond)
+	r.Start(1, 0)
+	time.Sleep(20 * time.Millisecond)
+	r.Done()
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) < 2 || !strings.Contains(lines[0], "scan progress:   0% posted 0/1 layers") {
+		t.Fatalf("no progress line before Done:\n%s", buf.String())
+	}
+	if last := lines[len(lines)-1]; !strings.Contains(last, "scan progress done:") {
+		t.Errorf("last line %q is not the done line", last)
+	}
+}
@@ -0,0 +1,272 @@
+package registryWrap
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/wadeling/clair-client/pkg/metrics"
+)
+
+const (
+	tokenClientID = "clair-client"
+	// cache label of the token cache metrics
+	tokenCache = "registry_token"
+	// registries that do not return expires_in issue tokens valid for at least 60s
+	defaultTokenLifetime = 60 * time.Second
+	// refresh tokens a bit before they expire
+	tokenExpiryLeeway = 5 * time.Second
+)
+
+type bearerToken struct {
+	token   string
+	expires time.Time
+}
+
+type tokenResponse struct {
+	Token       string `json:"token"`
+	AccessToken string `json:"access_token"`
+	ExpiresIn   int    `json:"expires_in"`
+}
+
+// authTransport authenticates registry requests. It answers Bearer challenges with
+// anonymous, basic or identity-token (OAuth2 refresh token) requests to the token
+// service and answers Basic challenges with the username/password.
+// Tokens are cached per repository so every blob download does not need a new token.
+type authTransport struct {
+	transport   http.RoundTripper
+	credentials Credentials
+
+	mu     sync.Mutex
+	tokens map[string]bearerToken // repository -> token
+}
+
+func newAuthTransport(transport http.RoundTripper, credentials Credentials) *authTransport {
+	return &authTransport{
+		transport:   transport,
+		credentials: credentials,
+		tokens:      make(map[string]bearerToken),
+	}
+}
+
+func (t *authTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if t.credentials.RegistryToken != "" {
+		return t.transport.RoundTrip(withAuthorization(req, "Bearer "+t.credentials.RegistryToken))
+	}
+
+	repo := repositoryFromPath(req.URL.Path)
+	if token, ok := t.cachedToken(repo); ok {
+		metrics.CacheHit(tokenCache)
+		req = withAuthorization(req, "Bearer "+token)
+	}
+
+	resp, err := t.transport.RoundTrip(req)
+	if err != nil || resp.StatusCode != http.StatusUnauthorized {
+		return resp, err
+	}
+
+	for _, challenge := range parseChallenges(resp.Header) {
+		switch challenge.scheme {
+		case "bearer":
+			metrics.CacheMiss(tokenCache)
+			token, err := t.fetchToken(req, challenge.params)
+			if err != nil {
+				resp.Body.Close()
+				return nil, err
+			}
+			t.storeToken(repo, token)
+			resp.Body.Close()
+			return t.transport.RoundTrip(withAuthorization(req, "Bearer "+token.token))
+		case "basic":
+			if t.credentials.Username == "" && t.credentials.Password == "" {
+				continue
+			}
+			resp.Body.Close()
+			retry := req.Clone(req.Context())
+			retry.SetBasicAuth(t.credentials.Username, t.credentials.Password)
+			return t.transport.RoundTrip(retry)
+		}
+	}
+	return resp, nil
+}
+
+// authorization returns the Authorization header value currently used for repo,
+// "" for anonymous registries that do not need a token
+func (t *authTransport) authorization(repo string) string {
+	if t.credentials.RegistryToken != "" {
+		return "Bearer " + t.credentials.RegistryToken
+	}
+	if token, ok := t.cachedToken(repo); ok {
+		return "Bearer " + token
+	}
+	if t.credentials.Username != "" || t.credentials.Password != "" {
+		auth := t.credentials.Username + ":" + t.credentials.Password
+		return "Basic " + base64.StdEncoding.EncodeToString([]byte(auth))
+	}
+	return ""
+}
+
+func (t *authTransport) cachedToken(repo string) (string, bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	tok, ok := t.tokens[repo]
+	if !ok || time.Now().After(tok.expires) {
+		return "", false
+	}
+	return tok.token, true
+}
+
+func (t *authTransport) storeToken(repo string, tok bearerToken) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.tokens[repo] = tok
+}
+
+// fetchToken requests a bearer token from the realm announced in a challenge
+func (t *authTransport) fetchToken(orig *http.Request, params map[string]string) (bearerToken, error) {
+	realm := params["realm"]
+	if realm == "" {
+		return bearerToken{}, fmt.Errorf("bearer challenge without realm")
+	}
+	realmUrl, err := url.Parse(realm)
+	if err != nil {
+		return bearerToken{}, fmt.Errorf("invalid token realm %s err %v", realm, err)
+	}
+
+	var req *http.Request
+	if t.credentials.IdentityToken != "" {
+		form := url.Values{}
+		form.Set("grant_type", "refresh_token")
+		form.Set("refresh_token", t.credentials.IdentityToken)
+		form.Set("service", params["service"])
+		form.Set("client_id", tokenClientID)
+		if params["scope"] != "" {
+			form.Set("scope", params["scope"])
+		}
+		req, err = http.NewRequest("POST", realmUrl.String(), strings.NewReader(form.Encode()))
+		if err != nil {
+			return bearerToken{}, err
+		}
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	} else {
+		q := realmUrl.Query()
+		if params["service"] != "" {
+			q.Set("service", params["service"])
+		}
+		if params["scope"] != "" {
+			q.Set("scope", params["scope"])
+		}
+		q.Set("client_id", tokenClientID)
+		realmUrl.RawQuery = q.Encode()
+		req, err = http.NewRequest("GET", realmUrl.String(), nil)
+		if err != nil {
+			return bearerToken{}, err
+		}
+		if t.credentials.Username != "" || t.credentials.Password != "" {
+			req.SetBasicAuth(t.credentials.Username, t.credentials.Password)
+		}
+	}
+
+	resp, err := t.transport.RoundTrip(req.WithContext(orig.Context()))
+	if err != nil {
+		return bearerToken{}, fmt.Errorf("request registry token err %v", err)
+	}
+	defer resp.Body.Close()
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return bearerToken{}, fmt.Errorf("read registry token response err %v", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return bearerToken{}, fmt.Errorf("registry token service %s returned %d: %s", realmUrl.Host, resp.StatusCode, string(body))
+	}
+
+	var tr tokenResponse
+	if err := json.Unmarshal(body, &tr); err != nil {
+		return bearerToken{}, fmt.Errorf("decode registry token response err %v", err)
+	}
+	token := tr.Token
+	if token == "" {
+		token = tr.AccessToken
+	}
+	if token == "" {
+		return bearerToken{}, fmt.Errorf("registry token service returned an empty token")
+	}
+	lifetime := defaultTokenLifetime
+	if tr.ExpiresIn > 0 {
+		lifetime = time.Duration(tr.ExpiresIn) * time.Second
+	}
+	return bearerToken{token: token, expires: time.Now().Add(lifetime - tokenExpiryLeeway)}, nil
+}
+
+// repositoryFromPath extracts the repository from /v2/<repo>/{manifests,blobs,tags}/...
+// and returns "" for other endpoints like the /v2/ ping
+func repositoryFromPath(p string) string {
+	p = strings.TrimPrefix(p, "/v2/")
+	for _, sep := range []string{"/manifests/", "/blobs/", "/tags/"} {
+		if i := strings.Index(p, sep); i > 0 {
+			return p[:i]
+		}
+	}
+	return ""
+}
+
+func withAuthorization(req *http.Request, value string) *http.Request {
+	r := req.Clone(req.Context())
+	r.Header.Set("Authorization", value)
+	return r
+}
+
+type challenge struct {
+	scheme string
+	params map[string]string
+}
+
+// parseChallenges parses WWW-Authenticate headers like
+// Bearer realm="https://auth.docker.io/token",service="registry.docker.io",scope="repository:library/busybox:pull"
+func parseChallenges(h http.Header) []challenge {
+	var challenges []challenge
+	for _, v := range h.Values("WWW-Authenticate") {
+		v = strings.TrimSpace(v)
+		i := strings.IndexByte(v, ' ')
+		if i < 0 {
+			challenges = append(challenges, challenge{scheme: strings.ToLower(v), params: map[string]string{}})
+			continue
+		}
+		c := challenge{scheme: strings.ToLower(v[:i]), params: make(map[string]string)}
+		rest := v[i+1:]
+		for rest != "" {
+			rest = strings.TrimLeft(rest, " ,")
+			eq := strings.IndexByte(rest, '=')
+			if eq < 0 {
+				break
+			}
+			key := strings.ToLower(strings.TrimSpace(rest[:eq]))
+			rest = rest[eq+1:]
+			var val string
+			if strings.HasPrefix(rest, `"`) {
+				end := strings.IndexByte(rest[1:], '"')
+				if end < 0 {
+					val, rest = rest[1:], ""
+				} else {
+					val, rest = rest[1:end+1], rest[end+2:]
+				}
+			} else {
+				end := strings.IndexByte(rest, ',')
+				if end < 0 {
+					val, rest = rest, ""
+				} else {
+					val, rest = rest[:end], rest[end:]
+				}
+			}
+			c.params[key] = val
+		}
+		challenges = append(challenges, c)
+	}
+	return challenges
+}
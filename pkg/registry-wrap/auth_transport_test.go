@@ -0,0 +1,78 @@
+package registryWrap
+
+import (
+	"net/http"
+	"reflect"
+	"testing"
+)
+
+func TestParseChallenges(t *testing.T) {
+	tests := []struct {
+		name    string
+		headers []string
+		want    []challenge
+	}{
+		{
+			name:    "bearer",
+			headers: []string{`Bearer realm="https://auth.docker.io/token",service="registry.docker.io",scope="repository:library/alpine:pull"`},
+			want: []challenge{{scheme: "bearer", params: map[string]string{
+				"realm":   "https://auth.docker.io/token",
+				"service": "registry.docker.io",
+				"scope":   "repository:library/alpine:pull",
+			}}},
+		},
+		{
+			name:    "basic",
+			headers: []string{`Basic realm="Registry Realm"`},
+			want:    []challenge{{scheme: "basic", params: map[string]string{"realm": "Registry Realm"}}},
+		},
+		{
+			name:    "scheme only",
+			headers: []string{"Basic"},
+			want:    []challenge{{scheme: "basic", params: map[string]string{}}},
+		},
+		{
+			name:    "unquoted values and spaces",
+			headers: []string{`Bearer realm=https://harbor/service/token, service=harbor-registry`},
+			want: []challenge{{scheme: "bearer", params: map[string]string{
+				"realm":   "https://harbor/service/token",
+				"service": "harbor-registry",
+			}}},
+		},
+		{
+			name:    "comma in quoted value",
+			headers: []string{`Bearer realm="https://auth/token",scope="repository:a:pull,push"`},
+			want: []challenge{{scheme: "bearer", params: map[string]string{
+				"realm": "https://auth/token",
+				"scope": "repository:a:pull,push",
+			}}},
+		},
+		{
+			name:    "unterminated quote",
+			headers: []string{`Bearer realm="https://auth/token`},
+			want:    []challenge{{scheme: "bearer", params: map[string]string{"realm": "https://auth/token"}}},
+		},
+		{
+			name:    "several headers",
+			headers: []string{`Basic realm="r"`, `Bearer realm="https://auth/token"`},
+			want: []challenge{
+				{scheme: "basic", params: map[string]string{"realm": "r"}},
+				{scheme: "bearer", params: map[string]string{"realm": "https://auth/token"}},
+			},
+		},
+		{
+			name: "none",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := http.Header{}
+			for _, v := range tt.headers {
+				h.Add("WWW-Authenticate", v)
+			}
+			if got := parseChallenges(h); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("parseChallenges() = %+v,want %+v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,265 @@
+package registryWrap
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	EnvRegistryUsername = "CLAIR_CLIENT_REGISTRY_USERNAME"
+	EnvRegistryPassword = "CLAIR_CLIENT_REGISTRY_PASSWORD"
+	EnvRegistryToken    = "CLAIR_CLIENT_REGISTRY_TOKEN"
+
+	// dockerHubConfigKey is the key docker login uses for Docker Hub in config.json
+	dockerHubConfigKey = "https://index.docker.io/v1/"
+	// credHelperTokenUser is the username a credential helper returns for identity tokens
+	credHelperTokenUser = "<token>"
+)
+
+// Credentials are the registry credentials used to authenticate against a registry.
+// The zero value means anonymous access.
+type Credentials struct {
+	Username string
+	Password string
+	// IdentityToken is an OAuth2 refresh token as stored by docker login for token-auth registries
+	IdentityToken string
+	// RegistryToken is a bearer token sent to the registry as is
+	RegistryToken string
+	// Source describes where the credentials came from, only used for logging
+	Source string
+}
+
+func (c Credentials) Anonymous() bool {
+	return c.Username == "" && c.Password == "" && c.IdentityToken == "" && c.RegistryToken == ""
+}
+
+// dockerConfigFile is the part of ~/.docker/config.json we care about
+type dockerConfigFile struct {
+	Auths       map[string]dockerAuthConfig `json:"auths"`
+	CredsStore  string                      `json:"credsStore"`
+	CredHelpers map[string]string           `json:"credHelpers"`
+}
+
+type dockerAuthConfig struct {
+	Auth          string `json:"auth"`
+	Username      string `json:"username"`
+	Password      string `json:"password"`
+	IdentityToken string `json:"identitytoken"`
+	RegistryToken string `json:"registrytoken"`
+}
+
+// credHelperResponse is the output of "docker-credential-<helper> get"
+type credHelperResponse struct {
+	ServerURL string `json:"ServerURL"`
+	Username  string `json:"Username"`
+	Secret    string `json:"Secret"`
+}
+
+// ResolveCredentials finds credentials for registryUrl. Explicit username/password win,
+// then environment variables, then the docker config file (credHelpers, credsStore, auths).
+// If nothing is found anonymous credentials are returned, so token-auth registries
+// like Docker Hub can still be used for public images.
+func ResolveCredentials(registryUrl, username, password string) (Credentials, error) {
+	if username != "" || password != "" {
+		return Credentials{Username: username, Password: password, Source: "command line"}, nil
+	}
+
+	if c, ok := credentialsFromEnv(); ok {
+		return c, nil
+	}
+
+	c, ok, err := credentialsFromDockerConfig(registryUrl)
+	if err != nil {
+		return Credentials{}, err
+	}
+	if ok {
+		return c, nil
+	}
+
+	return Credentials{Source: "anonymous"}, nil
+}
+
+// ResolveHostCredentials finds only the credentials stored for the host of registryUrl in the
+// docker config file. Explicit and environment credentials are not tied to a host,
+// use it for registries that are not the configured one so those are never sent there.
+func ResolveHostCredentials(registryUrl string) (Credentials, error) {
+	c, ok, err := credentialsFromDockerConfig(registryUrl)
+	if err != nil {
+		return Credentials{}, err
+	}
+	if ok {
+		return c, nil
+	}
+	return Credentials{Source: "anonymous"}, nil
+}
+
+func credentialsFromEnv() (Credentials, bool) {
+	c := Credentials{
+		Username:      os.Getenv(EnvRegistryUsername),
+		Password:      os.Getenv(EnvRegistryPassword),
+		RegistryToken: os.Getenv(EnvRegistryToken),
+		Source:        "environment",
+	}
+	return c, !c.Anonymous()
+}
+
+// dockerConfigPath returns the docker client config file, honouring $DOCKER_CONFIG
+func dockerConfigPath() (string, error) {
+	if dir := os.Getenv("DOCKER_CONFIG"); dir != "" {
+		return filepath.Join(dir, "config.json"), nil
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(home, ".docker", "config.json"), nil
+}
+
+func credentialsFromDockerConfig(registryUrl string) (Credentials, bool, error) {
+	path, err := dockerConfigPath()
+	if err != nil {
+		log.Debugf("can not locate docker config %v", err)
+		return Credentials{}, false, nil
+	}
+	data, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return Credentials{}, false, nil
+	}
+	if err != nil {
+		return Credentials{}, false, fmt.Errorf("read docker config %s err %v", path, err)
+	}
+
+	var cfg dockerConfigFile
+	if err := json.Unmarshal(data, &cfg); err != nil {
+		return Credentials{}, false, fmt.Errorf("parse docker config %s err %v", path, err)
+	}
+
+	host := registryHost(registryUrl)
+	serverUrl := host
+	if isDockerHub(host) {
+		serverUrl = dockerHubConfigKey
+	}
+
+	// credential helpers take precedence over auths, same as the docker cli
+	helper := ""
+	for k, v := range cfg.CredHelpers {
+		if registryHost(k) == host || (isDockerHub(host) && isDockerHub(registryHost(k))) {
+			helper = v
+			break
+		}
+	}
+	if helper == "" {
+		helper = cfg.CredsStore
+	}
+	if helper != "" {
+		c, ok, err := credentialsFromHelper(helper, serverUrl)
+		if err != nil {
+			return Credentials{}, false, err
+		}
+		if ok {
+			return c, true, nil
+		}
+	}
+
+	for k, v := range cfg.Auths {
+		kh := registryHost(k)
+		if kh != host && !(isDockerHub(host) && isDockerHub(kh)) {
+			continue
+		}
+		c, err := decodeDockerAuth(v)
+		if err != nil {
+			return Credentials{}, false, fmt.Errorf("decode auth for %s in %s err %v", k, path, err)
+		}
+		c.Source = path
+		return c, !c.Anonymous(), nil
+	}
+	return Credentials{}, false, nil
+}
+
+func decodeDockerAuth(a dockerAuthConfig) (Credentials, error) {
+	c := Credentials{
+		Username:      a.Username,
+		Password:      a.Password,
+		IdentityToken: a.IdentityToken,
+		RegistryToken: a.RegistryToken,
+	}
+	if a.Auth == "" {
+		return c, nil
+	}
+	decoded, err := base64.StdEncoding.DecodeString(a.Auth)
+	if err != nil {
+		return Credentials{}, err
+	}
+	parts := strings.SplitN(string(decoded), ":", 2)
+	if len(parts) != 2 {
+		return Credentials{}, fmt.Errorf("invalid auth field, expect user:password")
+	}
+	c.Username = parts[0]
+	c.Password = parts[1]
+	return c, nil
+}
+
+// credentialsFromHelper runs "docker-credential-<helper> get" with serverUrl on stdin
+func credentialsFromHelper(helper, serverUrl string) (Credentials, bool, error) {
+	program := "docker-credential-" + helper
+	cmd := exec.Command(program, "get")
+	cmd.Stdin = strings.NewReader(serverUrl)
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		out := strings.TrimSpace(stdout.String() + stderr.String())
+		if strings.Contains(out, "credentials not found") {
+			return Credentials{}, false, nil
+		}
+		if _, ok := err.(*exec.Error); ok {
+			// helper configured but not installed, fall back to auths like docker does
+			log.Warnf("credential helper %s not available: %v", program, err)
+			return Credentials{}, false, nil
+		}
+		return Credentials{}, false, fmt.Errorf("credential helper %s err %v: %s", program, err, out)
+	}
+
+	var resp credHelperResponse
+	if err := json.Unmarshal(stdout.Bytes(), &resp); err != nil {
+		return Credentials{}, false, fmt.Errorf("parse credential helper %s output err %v", program, err)
+	}
+	c := Credentials{Source: program}
+	if resp.Username == credHelperTokenUser {
+		c.IdentityToken = resp.Secret
+	} else {
+		c.Username = resp.Username
+		c.Password = resp.Secret
+	}
+	return c, !c.Anonymous(), nil
+}
+
+// registryHost returns host[:port] of a registry url or docker config key
+func registryHost(s string) string {
+	if !strings.Contains(s, "://") {
+		s = "//" + s
+	}
+	u, err := url.Parse(s)
+	if err != nil || u.Host == "" {
+		return strings.TrimSuffix(s, "/")
+	}
+	return u.Host
+}
+
+func isDockerHub(host string) bool {
+	switch host {
+	case "docker.io", "index.docker.io", "registry-1.docker.io", "registry.hub.docker.com":
+		return true
+	}
+	return false
+}
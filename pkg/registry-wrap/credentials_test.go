@@ -0,0 +1,108 @@
+package registryWrap
+
+import (
+	"encoding/base64"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestDecodeDockerAuth(t *testing.T) {
+	encode := func(s string) string { return base64.StdEncoding.EncodeToString([]byte(s)) }
+	tests := []struct {
+		name    string
+		auth    dockerAuthConfig
+		want    Credentials
+		wantErr bool
+	}{
+		{"auth field", dockerAuthConfig{Auth: encode("user:pass")}, Credentials{Username: "user", Password: "pass"}, false},
+		{"colon in password", dockerAuthConfig{Auth: encode("user:pa:ss")}, Credentials{Username: "user", Password: "pa:ss"}, false},
+		{"username and password", dockerAuthConfig{Username: "user", Password: "pass"}, Credentials{Username: "user", Password: "pass"}, false},
+		{"auth wins", dockerAuthConfig{Auth: encode("a:b"), Username: "user", Password: "pass"}, Credentials{Username: "a", Password: "b"}, false},
+		{"identity token", dockerAuthConfig{IdentityToken: "refresh"}, Credentials{IdentityToken: "refresh"}, false},
+		{"registry token", dockerAuthConfig{RegistryToken: "bearer"}, Credentials{RegistryToken: "bearer"}, false},
+		{"empty", dockerAuthConfig{}, Credentials{}, false},
+		{"not base64", dockerAuthConfig{Auth: "%%%"}, Credentials{}, true},
+		{"no colon", dockerAuthConfig{Auth: encode("user")}, Credentials{}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := decodeDockerAuth(tt.auth)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("decodeDockerAuth() err %v,wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("decodeDockerAuth() = %+v,want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+// setEnv sets or,for an empty value,unsets key for the test
+func setEnv(t *testing.T, key, value string) {
+	old, ok := os.LookupEnv(key)
+	if value == "" {
+		os.Unsetenv(key)
+	} else {
+		os.Setenv(key, value)
+	}
+	t.Cleanup(func() {
+		if ok {
+			os.Setenv(key, old)
+		} else {
+			os.Unsetenv(key)
+		}
+	})
+}
+
+func TestResolveCredentials(t *testing.T) {
+	dir := t.TempDir()
+	config := `{"auths":{
+		"harbor.example.com":{"auth":"` + base64.StdEncoding.EncodeToString([]byte("harbor:secret")) + `"},
+		"https://index.docker.io/v1/":{"auth":"` + base64.StdEncoding.EncodeToString([]byte("hub:secret")) + `"}
+	}}`
+	if err := ioutil.WriteFile(filepath.Join(dir, "config.json"), []byte(config), 0600); err != nil {
+		t.Fatal(err)
+	}
+	setEnv(t, "DOCKER_CONFIG", dir)
+
+	tests := []struct {
+		name       string
+		url        string
+		username   string
+		password   string
+		envUser    string
+		hostOnly   bool
+		wantUser   string
+		wantSource string
+	}{
+		{name: "explicit", url: "https://harbor.example.com", username: "cli", password: "pw", wantUser: "cli", wantSource: "command line"},
+		{name: "environment", url: "https://harbor.example.com", envUser: "env", wantUser: "env", wantSource: "environment"},
+		{name: "docker config", url: "https://harbor.example.com", wantUser: "harbor", wantSource: filepath.Join(dir, "config.json")},
+		{name: "docker hub", url: "https://registry-1.docker.io", wantUser: "hub", wantSource: filepath.Join(dir, "config.json")},
+		{name: "unknown host", url: "https://other.example.com", wantSource: "anonymous"},
+		{name: "host only ignores environment", url: "https://other.example.com", envUser: "env", hostOnly: true, wantSource: "anonymous"},
+		{name: "host only uses docker config", url: "https://harbor.example.com", envUser: "env", hostOnly: true, wantUser: "harbor", wantSource: filepath.Join(dir, "config.json")},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			setEnv(t, EnvRegistryUsername, tt.envUser)
+			setEnv(t, EnvRegistryPassword, "")
+			setEnv(t, EnvRegistryToken, "")
+			var got Credentials
+			var err error
+			if tt.hostOnly {
+				got, err = ResolveHostCredentials(tt.url)
+			} else {
+				got, err = ResolveCredentials(tt.url, tt.username, tt.password)
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got.Username != tt.wantUser || got.Source != tt.wantSource {
+				t.Errorf("credentials = %+v,want user %q from %q", got, tt.wantUser, tt.wantSource)
+			}
+		})
+	}
+}
@@ -3,13 +3,19 @@ package registryWrap
 
 import (
 	"context"
+	"crypto/tls"
 	"crypto/x509"
 	"errors"
 	"fmt"
 	"github.com/heroku/docker-registry-client/registry"
 	"github.com/opencontainers/go-digest"
+	"github.com/wadeling/clair-client/pkg/logging"
+	"github.com/wadeling/clair-client/pkg/metrics"
+	"github.com/wadeling/clair-client/pkg/retry"
 	log "github.com/sirupsen/logrus"
 	"io"
+	"net/http"
+	"strings"
 	"time"
 )
 
@@ -20,23 +26,26 @@ const (
 
 type RegistryClient struct {
 	ctx 		context.Context
-	username 	string
-	password 	string
+	credentials	Credentials
 	repository 	string
 	url 		string				//registry url
 	skipRegistryTLSVerify bool
 	registryClient *registry.Registry
+	auth *authTransport
 }
 
-func NewRegistryClient(username,password,repository,url string,skipRegistryTLSVerify bool) (*RegistryClient,error){
+// NewRegistryClient creates a registry client authenticating with credentials,
+// see ResolveCredentials. Bearer token flows (Docker Hub, Harbor) work with anonymous credentials too.
+func NewRegistryClient(credentials Credentials,repository,url string,skipRegistryTLSVerify bool) (*RegistryClient,error){
 	rci := &RegistryClient{
-		username: username,
-		password: password,
+		credentials: credentials,
 		repository: repository,
 		url: url,
 		skipRegistryTLSVerify: skipRegistryTLSVerify,
 	}
-	client, err := registry.New(url, username, password)
+	logger := log.WithField("registry",url)
+	logger.Infof("use %s credentials",credentials.Source)
+	client, auth, err := newRegistry(url, credentials, http.DefaultTransport)
 	if err != nil && skipRegistryTLSVerify {
 		// seems like error Golang's x509 package doesn't support error wrapping API yet:
 		// https://github.com/golang/go/issues/30322
@@ -50,18 +59,43 @@ func NewRegistryClient(username,password,repository,url string,skipRegistryTLSVe
 		_, ok3 := errors.Unwrap(err).(x509.UnknownAuthorityError)
 		_, ok4 := errors.Unwrap(err).(x509.HostnameError)
 		if ok1 || ok2 || ok3 || ok4 {
-			log.Info("Certificate validation failed, but insecure option is on - will retry and skip TLS cert verification")
-			client, err = registry.NewInsecure(url, username, password)
+			logger.Info("Certificate validation failed, but insecure option is on - will retry and skip TLS cert verification")
+			insecure := &http.Transport{
+				Proxy:           http.ProxyFromEnvironment,
+				TLSClientConfig: &tls.Config{InsecureSkipVerify: true},
+			}
+			client, auth, err = newRegistry(url, credentials, insecure)
 		}
 	}
 	if err != nil {
-		log.Errorf("create new registry client err:%v",err)
+		logger.Errorf("create new registry client err:%v",err)
 		return nil,err
 	}
 	rci.registryClient = client
+	rci.auth = auth
 	return rci,nil
 }
 
+// newRegistry is registry.New with our own auth transport, which supports identity tokens,
+// static registry tokens and caches bearer tokens per repository
+func newRegistry(url string, credentials Credentials, transport http.RoundTripper) (*registry.Registry, *authTransport, error) {
+	url = strings.TrimSuffix(url, "/")
+	auth := newAuthTransport(transport, credentials)
+	r := &registry.Registry{
+		URL: url,
+		Client: &http.Client{
+			Transport: &registry.ErrorTransport{
+				Transport: auth,
+			},
+		},
+		Logf: registry.Log,
+	}
+	if err := r.Ping(); err != nil {
+		return nil, nil, err
+	}
+	return r, auth, nil
+}
+
 func (rc *RegistryClient) GetLayers(version,repository,digest string ) ([]string, error) {
 	layers := make([]string, 0)
 	uniqueLayers := make(map[string]bool)
@@ -79,32 +113,110 @@ func (rc *RegistryClient) GetLayers(version,repository,digest string ) ([]string
 			layers = append([]string{layerDigest}, layers...)
 		}
 	} else if version == "v2" {
-		manifest, err := rc.registryClient.ManifestV2(repository, digest)
+		infos, err := rc.GetManifestLayers(repository, digest)
 		if err != nil {
-			return []string{}, fmt.Errorf("Could not read docker V2 manifest: %w", err)
+			return []string{}, err
 		}
-		for _, layer := range manifest.Manifest.Layers {
-			layerDigest := layer.Digest.String()
-			if _, ok := uniqueLayers[layerDigest]; ok {
-				return []string{}, fmt.Errorf("Found duplicate layer digest in V2 manifest")
-			}
-			uniqueLayers[layerDigest] = true
-			layers = append(layers, layerDigest)
+		for _, layer := range infos {
+			layers = append(layers, layer.Digest)
 		}
 	}
 	return layers, nil
 }
 
-func (rc *RegistryClient) DownloadBlob(repository string,digest digest.Digest) (r io.ReadCloser,err error) {
-	for i:=0 ; i < RegistryClientRetryCount; i++ {
-		r,err = rc.registryClient.DownloadBlob(repository,digest)
-		if err == nil {
-			return r,err
+// LayerInfo is a layer of a v2 image manifest
+type LayerInfo struct {
+	Digest    string
+	Size      int64
+	MediaType string
+}
+
+// GetManifestLayers returns the layers of the v2 manifest,bottom layer first
+func (rc *RegistryClient) GetManifestLayers(repository,digest string) ([]LayerInfo,error) {
+	manifest, err := rc.registryClient.ManifestV2(repository, digest)
+	if err != nil {
+		return nil, fmt.Errorf("Could not read docker V2 manifest: %w", err)
+	}
+	layers := make([]LayerInfo, 0, len(manifest.Manifest.Layers))
+	uniqueLayers := make(map[string]bool)
+	for _, layer := range manifest.Manifest.Layers {
+		layerDigest := layer.Digest.String()
+		if _, ok := uniqueLayers[layerDigest]; ok {
+			return nil, fmt.Errorf("Found duplicate layer digest in V2 manifest")
+		}
+		uniqueLayers[layerDigest] = true
+		layers = append(layers, LayerInfo{Digest: layerDigest, Size: layer.Size, MediaType: layer.MediaType})
+	}
+	return layers, nil
+}
+
+// DownloadBlob downloads a blob,retrying transient errors until ctx is done.
+// Canceling ctx also aborts reading the returned body.
+func (rc *RegistryClient) DownloadBlob(ctx context.Context,repository string,digest digest.Digest) (r io.ReadCloser,err error) {
+	policy := retry.DefaultPolicy
+	policy.MaxAttempts = RegistryClientRetryCount
+	policy.InitialInterval = RegistryClientRetryInterval
+	logger := logging.FromContext(ctx).WithField(logging.FieldLayer,digest.String())
+	err = policy.Do(ctx, func(ctx context.Context) error {
+		r,err = rc.downloadBlob(ctx,repository,digest)
+		if err != nil {
+			logger.Warnf("download blob err %v",err)
 		}
-		time.Sleep(time.Duration(RegistryClientRetryInterval) * time.Second)
+		return err
+	}, isRetryableRegistryError)
+	if err != nil {
+		return nil,err
 	}
-	return nil,err
+	return metrics.InstrumentDownload(r),nil
 }
+
+// downloadBlob is registry.DownloadBlob with a request context,the registry library ignores contexts
+func (rc *RegistryClient) downloadBlob(ctx context.Context,repository string,digest digest.Digest) (io.ReadCloser,error) {
+	url := rc.BlobURL(repository,digest)
+	rc.registryClient.Logf("registry.blob.download url=%s repository=%s digest=%s",url,repository,digest)
+	req,err := http.NewRequestWithContext(ctx,http.MethodGet,url,nil)
+	if err != nil {
+		return nil,err
+	}
+	resp,err := rc.registryClient.Client.Do(req)
+	if err != nil {
+		return nil,err
+	}
+	return resp.Body,nil
+}
+
+// isRetryableRegistryError retries everything but client errors,except 429 too many requests
+func isRetryableRegistryError(err error) bool {
+	var statusErr *registry.HTTPStatusError
+	if errors.As(err, &statusErr) {
+		code := statusErr.Response.StatusCode
+		return code >= http.StatusInternalServerError || code == http.StatusTooManyRequests
+	}
+	return true
+}
+
 func (rc *RegistryClient) GetManifestDigest(repository,tag string) (digest.Digest,error) {
 	return rc.registryClient.ManifestDigest(repository,tag)
-}
\ No newline at end of file
+}
+
+// BlobURL is the registry api url of a blob,clair can download it directly with BlobHeaders
+func (rc *RegistryClient) BlobURL(repository string,digest digest.Digest) string {
+	return fmt.Sprintf("%s/v2/%s/blobs/%s",rc.registryClient.URL,repository,digest)
+}
+
+// BlobHeaders returns the headers needed to download a blob of repository,i.e. a fresh
+// bearer token or basic auth. The token is fetched by checking the blob exists.
+func (rc *RegistryClient) BlobHeaders(repository string,digest digest.Digest) (map[string]string,error) {
+	ok,err := rc.registryClient.HasBlob(repository,digest)
+	if err != nil {
+		return nil,fmt.Errorf("check blob %s err %v",digest,err)
+	}
+	if !ok {
+		return nil,fmt.Errorf("blob %s not found in %s",digest,repository)
+	}
+	headers := make(map[string]string)
+	if auth := rc.auth.authorization(repository); auth != "" {
+		headers["Authorization"] = auth
+	}
+	return headers,nil
+}
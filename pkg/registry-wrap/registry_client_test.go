@@ -0,0 +1,61 @@
+package registryWrap
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/opencontainers/go-digest"
+)
+
+func TestDownloadBlobCancel(t *testing.T) {
+	// the registry sends the start of the blob and then stalls until the client goes away
+	stalled := make(chan struct{})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/v2/" {
+			return
+		}
+		w.Write([]byte("start"))
+		w.(http.Flusher).Flush()
+		select {
+		case <-r.Context().Done():
+		case <-stalled:
+		}
+	}))
+	defer srv.Close()
+	defer close(stalled)
+
+	rc, err := NewRegistryClient(Credentials{}, "library/alpine", srv.URL, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	r, err := rc.DownloadBlob(ctx, "library/alpine", digest.FromString("layer"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	buf := make([]byte, len("start"))
+	if _, err := io.ReadFull(r, buf); err != nil {
+		t.Fatal(err)
+	}
+
+	cancel()
+	done := make(chan error, 1)
+	go func() {
+		_, err := r.Read(buf)
+		done <- err
+	}()
+	select {
+	case err := <-done:
+		if err == nil {
+			t.Error("read after cancel succeeded")
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("read of a stalled blob did not return after cancel")
+	}
+}
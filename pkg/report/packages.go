@@ -0,0 +1,68 @@
+package report
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"sort"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/wadeling/clair-client/pkg/model"
+)
+
+// PackageFormats are the report formats of the package inventory
+var PackageFormats = []string{FormatJSON, FormatTable, FormatCSV}
+
+// ReadPackages reads the package inventory a scan wrote to its packages file
+func ReadPackages(path string) ([]model.Package, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("read packages %s err %v", path, err)
+	}
+	var packages []model.Package
+	if err := json.Unmarshal(data, &packages); err != nil {
+		return nil, fmt.Errorf("parse packages %s err %v", path, err)
+	}
+	return packages, nil
+}
+
+// RenderPackages writes the package inventory to w in format,sorted by name and version
+func RenderPackages(w io.Writer, format string, packages []model.Package) error {
+	switch format {
+	case FormatJSON:
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(packages)
+	case FormatTable:
+		tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+		fmt.Fprintln(tw, "NAME\tVERSION\tFORMAT\tNAMESPACE\tVULNERABILITIES\tADDED BY")
+		for _, p := range sortedPackages(packages) {
+			fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%d\t%s\n", p.Name, p.Version, p.VersionFormat, p.Namespace, p.Vulnerabilities, p.AddedBy)
+		}
+		return tw.Flush()
+	case FormatCSV:
+		cw := csv.NewWriter(w)
+		cw.Write([]string{"name", "version", "version_format", "namespace", "vulnerabilities", "added_by"})
+		for _, p := range sortedPackages(packages) {
+			cw.Write([]string{p.Name, p.Version, p.VersionFormat, p.Namespace, strconv.Itoa(p.Vulnerabilities), p.AddedBy})
+		}
+		cw.Flush()
+		return cw.Error()
+	}
+	return fmt.Errorf("unknown package format %s,supported: %s", format, strings.Join(PackageFormats, ","))
+}
+
+func sortedPackages(packages []model.Package) []model.Package {
+	out := append([]model.Package(nil), packages...)
+	sort.SliceStable(out, func(i, j int) bool {
+		if out[i].Name != out[j].Name {
+			return out[i].Name < out[j].Name
+		}
+		return out[i].Version < out[j].Version
+	})
+	return out
+}
@@ -0,0 +1,189 @@
+package report
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"sort"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/wadeling/clair-client/pkg/model"
+)
+
+const (
+	FormatJSON    = "json"
+	FormatTable   = "table"
+	FormatCSV     = "csv"
+	FormatNames   = "names"
+	FormatSummary = "summary"
+)
+
+// Formats are the supported report formats
+var Formats = []string{FormatJSON, FormatTable, FormatCSV, FormatNames, FormatSummary}
+
+// ReadResult reads the vulnerabilities a scan wrote to its result file
+func ReadResult(path string) ([]model.VulnerabilityInfo, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("read result %s err %v", path, err)
+	}
+	var vulnerabilities []model.VulnerabilityInfo
+	if err := json.Unmarshal(data, &vulnerabilities); err != nil {
+		return nil, fmt.Errorf("parse result %s err %v", path, err)
+	}
+	return vulnerabilities, nil
+}
+
+// Render writes the vulnerabilities to w in format
+func Render(w io.Writer, format string, vulnerabilities []model.VulnerabilityInfo) error {
+	switch format {
+	case FormatJSON:
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(vulnerabilities)
+	case FormatTable:
+		return renderTable(w, sorted(vulnerabilities))
+	case FormatCSV:
+		return renderCSV(w, sorted(vulnerabilities))
+	case FormatNames:
+		_, err := io.WriteString(w, Names(vulnerabilities))
+		return err
+	case FormatSummary:
+		return renderSummary(w, vulnerabilities)
+	}
+	return fmt.Errorf("unknown format %s,supported: %s", format, strings.Join(Formats, ","))
+}
+
+// Names returns the sorted unique vulnerability ids,one per line. used to diff with trivy
+func Names(vulnerabilities []model.VulnerabilityInfo) string {
+	names := make(map[string]bool)
+	for _, v := range vulnerabilities {
+		names[v.ID] = true
+	}
+	keys := make([]string, 0, len(names))
+	for k := range names {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	var b strings.Builder
+	for _, k := range keys {
+		b.WriteString(k + "\n")
+	}
+	return b.String()
+}
+
+// GroupByID merges the vulnerabilities with the same id,e.g. a CVE found in openssl and libssl1.1,
+// into one with all affected packages in Packages. The highest severity of the merged ones is kept.
+func GroupByID(vulnerabilities []model.VulnerabilityInfo) []model.VulnerabilityInfo {
+	index := make(map[string]int)
+	grouped := make([]model.VulnerabilityInfo, 0, len(vulnerabilities))
+	for _, v := range vulnerabilities {
+		i, ok := index[v.ID]
+		if !ok {
+			v.Packages = append([]model.AffectedPackage(nil), v.AffectedPackages()...)
+			index[v.ID] = len(grouped)
+			grouped = append(grouped, v)
+			continue
+		}
+		g := &grouped[i]
+		for _, p := range v.AffectedPackages() {
+			if !hasPackage(g.Packages, p) {
+				g.Packages = append(g.Packages, p)
+			}
+		}
+		if model.SeverityRank(v.Severity) > model.SeverityRank(g.Severity) {
+			g.Severity = v.Severity
+		}
+	}
+	return grouped
+}
+
+func hasPackage(packages []model.AffectedPackage, p model.AffectedPackage) bool {
+	for _, q := range packages {
+		if q.FeatureName == p.FeatureName && q.FeatureVersion == p.FeatureVersion {
+			return true
+		}
+	}
+	return false
+}
+
+// CountBySeverity returns the number of vulnerabilities per severity
+func CountBySeverity(vulnerabilities []model.VulnerabilityInfo) map[string]int {
+	sta := make(map[string]int)
+	for _, v := range vulnerabilities {
+		sta[v.Severity]++
+	}
+	return sta
+}
+
+// sorted orders by severity,highest first,then by id and package
+func sorted(vulnerabilities []model.VulnerabilityInfo) []model.VulnerabilityInfo {
+	out := append([]model.VulnerabilityInfo(nil), vulnerabilities...)
+	sort.SliceStable(out, func(i, j int) bool {
+		ri, rj := model.SeverityRank(out[i].Severity), model.SeverityRank(out[j].Severity)
+		if ri != rj {
+			return ri > rj
+		}
+		if out[i].ID != out[j].ID {
+			return out[i].ID < out[j].ID
+		}
+		return out[i].FeatureName < out[j].FeatureName
+	})
+	return out
+}
+
+func renderTable(w io.Writer, vulnerabilities []model.VulnerabilityInfo) error {
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "SEVERITY\tID\tPACKAGE\tVERSION\tFIXED BY")
+	for _, v := range vulnerabilities {
+		name, version, fixedBy := packageColumns(v)
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\n", v.Severity, v.ID, name, version, fixedBy)
+	}
+	return tw.Flush()
+}
+
+func renderCSV(w io.Writer, vulnerabilities []model.VulnerabilityInfo) error {
+	cw := csv.NewWriter(w)
+	cw.Write([]string{"severity", "id", "package", "version", "fixed_by", "namespace", "cvssv3_score", "link"})
+	for _, v := range vulnerabilities {
+		link := ""
+		if len(v.Links) > 0 {
+			link = v.Links[0]
+		}
+		name, version, fixedBy := packageColumns(v)
+		cw.Write([]string{v.Severity, v.ID, name, version, fixedBy, v.Namespace, v.CVSS.CVSSv3Score, link})
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+// packageColumns joins the names,versions and fixed versions of the affected packages with commas
+func packageColumns(v model.VulnerabilityInfo) (string, string, string) {
+	var names, versions, fixedBy []string
+	for _, p := range v.AffectedPackages() {
+		names = append(names, p.FeatureName)
+		versions = append(versions, p.FeatureVersion)
+		fixedBy = append(fixedBy, p.FixedBy)
+	}
+	return strings.Join(names, ","), strings.Join(versions, ","), strings.Join(fixedBy, ",")
+}
+
+func renderSummary(w io.Writer, vulnerabilities []model.VulnerabilityInfo) error {
+	sta := CountBySeverity(vulnerabilities)
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	for i := len(model.Severities) - 1; i >= 0; i-- {
+		fmt.Fprintf(tw, "%s\t%d\n", model.Severities[i], sta[model.Severities[i]])
+	}
+	// severities clair may add later
+	for severity, num := range sta {
+		if model.SeverityRank(severity) < 0 {
+			fmt.Fprintf(tw, "%s\t%d\n", severity, num)
+		}
+	}
+	fmt.Fprintf(tw, "Total\t%d\n", len(vulnerabilities))
+	return tw.Flush()
+}
@@ -0,0 +1,76 @@
+package report
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/wadeling/clair-client/pkg/model"
+)
+
+func TestGroupByID(t *testing.T) {
+	vuln := func(id, name, version, severity string) model.VulnerabilityInfo {
+		return model.VulnerabilityInfo{ID: id, FeatureName: name, FeatureVersion: version, FixedBy: version + "-fix", Severity: severity}
+	}
+	pkg := func(name, version string) model.AffectedPackage {
+		return model.AffectedPackage{FeatureName: name, FeatureVersion: version, FixedBy: version + "-fix"}
+	}
+	type group struct {
+		id       string
+		severity string
+		packages []model.AffectedPackage
+	}
+	tests := []struct {
+		name string
+		in   []model.VulnerabilityInfo
+		want []group
+	}{
+		{"empty", nil, []group{}},
+		{"single", []model.VulnerabilityInfo{vuln("CVE-1", "openssl", "1.1", "High")},
+			[]group{{"CVE-1", "High", []model.AffectedPackage{pkg("openssl", "1.1")}}}},
+		{"same id in two packages",
+			[]model.VulnerabilityInfo{vuln("CVE-1", "openssl", "1.1", "Medium"), vuln("CVE-1", "libssl1.1", "1.1", "Medium")},
+			[]group{{"CVE-1", "Medium", []model.AffectedPackage{pkg("openssl", "1.1"), pkg("libssl1.1", "1.1")}}}},
+		{"highest severity is kept",
+			[]model.VulnerabilityInfo{vuln("CVE-1", "a", "1", "Low"), vuln("CVE-1", "b", "1", "Critical"), vuln("CVE-1", "c", "1", "Medium")},
+			[]group{{"CVE-1", "Critical", []model.AffectedPackage{pkg("a", "1"), pkg("b", "1"), pkg("c", "1")}}}},
+		{"duplicate package",
+			[]model.VulnerabilityInfo{vuln("CVE-1", "a", "1", "Low"), vuln("CVE-1", "a", "1", "Low")},
+			[]group{{"CVE-1", "Low", []model.AffectedPackage{pkg("a", "1")}}}},
+		{"order of first occurrence",
+			[]model.VulnerabilityInfo{vuln("CVE-2", "a", "1", "Low"), vuln("CVE-1", "a", "1", "High"), vuln("CVE-2", "b", "2", "Low")},
+			[]group{
+				{"CVE-2", "Low", []model.AffectedPackage{pkg("a", "1"), pkg("b", "2")}},
+				{"CVE-1", "High", []model.AffectedPackage{pkg("a", "1")}},
+			}},
+		{"already grouped",
+			[]model.VulnerabilityInfo{
+				{ID: "CVE-1", Severity: "Low", Packages: []model.AffectedPackage{pkg("a", "1"), pkg("b", "1")}},
+				vuln("CVE-1", "b", "1", "Low"),
+				vuln("CVE-1", "c", "1", "Low"),
+			},
+			[]group{{"CVE-1", "Low", []model.AffectedPackage{pkg("a", "1"), pkg("b", "1"), pkg("c", "1")}}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := GroupByID(tt.in)
+			groups := make([]group, 0, len(got))
+			for _, v := range got {
+				groups = append(groups, group{v.ID, v.Severity, v.Packages})
+			}
+			if !reflect.DeepEqual(groups, tt.want) {
+				t.Errorf("GroupByID() = %+v,want %+v", groups, tt.want)
+			}
+		})
+	}
+}
+
+func TestGroupByIDKeepsInput(t *testing.T) {
+	in := []model.VulnerabilityInfo{
+		{ID: "CVE-1", FeatureName: "a", FeatureVersion: "1", Packages: []model.AffectedPackage{{FeatureName: "a", FeatureVersion: "1"}}},
+		{ID: "CVE-1", FeatureName: "b", FeatureVersion: "1"},
+	}
+	GroupByID(in)
+	if len(in[0].Packages) != 1 {
+		t.Errorf("GroupByID changed the packages of its input: %+v", in[0].Packages)
+	}
+}
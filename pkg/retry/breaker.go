@@ -0,0 +1,84 @@
+package retry
+
+import (
+	"errors"
+	"sync"
+	"time"
+)
+
+// ErrCircuitOpen is returned by Breaker.Allow while the breaker is open
+var ErrCircuitOpen = errors.New("circuit breaker is open")
+
+type breakerState int
+
+const (
+	stateClosed breakerState = iota
+	stateOpen
+	stateHalfOpen
+)
+
+// Breaker stops calls to a failing service. After FailureThreshold consecutive failures it
+// opens and rejects calls for OpenTimeout,then lets a single probe through (half open);
+// the probe's outcome closes or reopens it.
+type Breaker struct {
+	FailureThreshold int
+	OpenTimeout      time.Duration
+
+	mu       sync.Mutex
+	state    breakerState
+	failures int
+	openedAt time.Time
+}
+
+func NewBreaker(failureThreshold int, openTimeout time.Duration) *Breaker {
+	return &Breaker{
+		FailureThreshold: failureThreshold,
+		OpenTimeout:      openTimeout,
+	}
+}
+
+// Allow returns ErrCircuitOpen if the call must not be made
+func (b *Breaker) Allow() error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	switch b.state {
+	case stateOpen:
+		if time.Since(b.openedAt) < b.OpenTimeout {
+			return ErrCircuitOpen
+		}
+		b.state = stateHalfOpen
+		return nil
+	case stateHalfOpen:
+		// a probe is in flight
+		return ErrCircuitOpen
+	}
+	return nil
+}
+
+func (b *Breaker) Success() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.state = stateClosed
+	b.failures = 0
+}
+
+// Release ends a call whose outcome is unknown,e.g. its context was cancelled.
+// A released probe reopens the breaker so the next call probes again.
+func (b *Breaker) Release() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.state == stateHalfOpen {
+		// openedAt is older than OpenTimeout,Allow lets the next probe through
+		b.state = stateOpen
+	}
+}
+
+func (b *Breaker) Failure() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.failures++
+	if b.state == stateHalfOpen || b.failures >= b.FailureThreshold {
+		b.state = stateOpen
+		b.openedAt = time.Now()
+	}
+}
@@ -0,0 +1,50 @@
+package retry
+
+import (
+	"testing"
+	"time"
+)
+
+func TestBreaker(t *testing.T) {
+	const timeout = 20 * time.Millisecond
+	tests := []struct {
+		name string
+		// steps run in order,"allow" and "deny" check Allow,"wait" sleeps past OpenTimeout
+		steps []string
+	}{
+		{"closed allows", []string{"allow", "allow"}},
+		{"failures below threshold", []string{"failure", "allow", "failure", "allow"}},
+		{"success resets failures", []string{"failure", "failure", "success", "failure", "allow"}},
+		{"opens at threshold", []string{"failure", "failure", "failure", "deny"}},
+		{"half open after timeout", []string{"failure", "failure", "failure", "wait", "allow", "deny"}},
+		{"probe success closes", []string{"failure", "failure", "failure", "wait", "allow", "success", "allow", "allow"}},
+		{"probe failure reopens", []string{"failure", "failure", "failure", "wait", "allow", "failure", "deny", "wait", "allow"}},
+		{"released probe lets the next one through", []string{"failure", "failure", "failure", "wait", "allow", "release", "allow", "deny"}},
+		{"release while closed", []string{"release", "allow", "allow"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b := NewBreaker(3, timeout)
+			for i, step := range tt.steps {
+				switch step {
+				case "allow":
+					if err := b.Allow(); err != nil {
+						t.Fatalf("step %d: Allow() = %v,want nil", i, err)
+					}
+				case "deny":
+					if err := b.Allow(); err != ErrCircuitOpen {
+						t.Fatalf("step %d: Allow() = %v,want ErrCircuitOpen", i, err)
+					}
+				case "success":
+					b.Success()
+				case "failure":
+					b.Failure()
+				case "release":
+					b.Release()
+				case "wait":
+					time.Sleep(timeout + 5*time.Millisecond)
+				}
+			}
+		})
+	}
+}
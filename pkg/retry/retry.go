@@ -0,0 +1,93 @@
+package retry
+
+import (
+	"context"
+	"errors"
+	"math"
+	"math/rand"
+	"time"
+)
+
+// Policy is an exponential backoff with jitter
+type Policy struct {
+	// MaxAttempts including the first one,values < 1 mean a single attempt
+	MaxAttempts     int
+	InitialInterval time.Duration
+	MaxInterval     time.Duration
+	Multiplier      float64
+	// Jitter randomises each interval by +-Jitter*interval,0 <= Jitter <= 1
+	Jitter float64
+}
+
+// DefaultPolicy waits about 0.5s,1s,2s,4s between 5 attempts,enough to ride out a clair restart
+var DefaultPolicy = Policy{
+	MaxAttempts:     5,
+	InitialInterval: 500 * time.Millisecond,
+	MaxInterval:     30 * time.Second,
+	Multiplier:      2,
+	Jitter:          0.2,
+}
+
+// NoRetry runs the operation once
+var NoRetry = Policy{MaxAttempts: 1}
+
+type permanentError struct {
+	err error
+}
+
+func (e *permanentError) Error() string { return e.err.Error() }
+func (e *permanentError) Unwrap() error { return e.err }
+
+// Permanent marks err as not retryable regardless of the retryable func passed to Do
+func Permanent(err error) error {
+	if err == nil {
+		return nil
+	}
+	return &permanentError{err: err}
+}
+
+// Backoff returns the wait after the given attempt (1 based),with jitter applied
+func (p Policy) Backoff(attempt int) time.Duration {
+	multiplier := p.Multiplier
+	if multiplier < 1 {
+		multiplier = 1
+	}
+	d := float64(p.InitialInterval) * math.Pow(multiplier, float64(attempt-1))
+	if p.MaxInterval > 0 && d > float64(p.MaxInterval) {
+		d = float64(p.MaxInterval)
+	}
+	if p.Jitter > 0 {
+		d += d * p.Jitter * (2*rand.Float64() - 1)
+	}
+	return time.Duration(d)
+}
+
+// Do runs op until it succeeds,returns a non retryable error,the attempts are used up
+// or ctx is done. retryable decides which errors are transient,nil retries all errors.
+func (p Policy) Do(ctx context.Context, op func(ctx context.Context) error, retryable func(error) bool) error {
+	var err error
+	for attempt := 1; ; attempt++ {
+		err = op(ctx)
+		if err == nil {
+			return nil
+		}
+		var perm *permanentError
+		if errors.As(err, &perm) {
+			return perm.err
+		}
+		if attempt >= p.MaxAttempts || (retryable != nil && !retryable(err)) {
+			return err
+		}
+		if ctx.Err() != nil {
+			return err
+		}
+
+		t := time.NewTimer(p.Backoff(attempt))
+		select {
+		case <-ctx.Done():
+			t.Stop()
+			return err
+		case <-t.C:
+		}
+	}
+}
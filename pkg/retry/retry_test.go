@@ -0,0 +1,81 @@
+package retry
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestBackoff(t *testing.T) {
+	p := Policy{InitialInterval: 100 * time.Millisecond, MaxInterval: time.Second, Multiplier: 2}
+	tests := []struct {
+		attempt int
+		want    time.Duration
+	}{
+		{1, 100 * time.Millisecond},
+		{2, 200 * time.Millisecond},
+		{3, 400 * time.Millisecond},
+		{4, 800 * time.Millisecond},
+		{5, time.Second},
+		{10, time.Second},
+	}
+	for _, tt := range tests {
+		if got := p.Backoff(tt.attempt); got != tt.want {
+			t.Errorf("Backoff(%d) = %v,want %v", tt.attempt, got, tt.want)
+		}
+	}
+}
+
+func TestBackoffJitter(t *testing.T) {
+	p := Policy{InitialInterval: 100 * time.Millisecond, Multiplier: 2, Jitter: 0.2}
+	for i := 0; i < 100; i++ {
+		if got := p.Backoff(2); got < 160*time.Millisecond || got > 240*time.Millisecond {
+			t.Fatalf("Backoff(2) = %v,want 200ms +-20%%", got)
+		}
+	}
+}
+
+func TestDo(t *testing.T) {
+	errTransient := errors.New("transient")
+	errFatal := errors.New("fatal")
+	p := Policy{MaxAttempts: 3, InitialInterval: time.Millisecond}
+	tests := []struct {
+		name      string
+		errs      []error
+		wantCalls int
+		wantErr   error
+	}{
+		{"success", []error{nil}, 1, nil},
+		{"retry then success", []error{errTransient, nil}, 2, nil},
+		{"attempts used up", []error{errTransient, errTransient, errTransient, nil}, 3, errTransient},
+		{"not retryable", []error{errFatal, nil}, 1, errFatal},
+		{"permanent", []error{Permanent(errTransient), nil}, 1, errTransient},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			calls := 0
+			err := p.Do(context.Background(), func(context.Context) error {
+				err := tt.errs[calls]
+				calls++
+				return err
+			}, func(err error) bool { return err == errTransient })
+			if err != tt.wantErr || calls != tt.wantCalls {
+				t.Errorf("Do() = %v after %d calls,want %v after %d", err, calls, tt.wantErr, tt.wantCalls)
+			}
+		})
+	}
+}
+
+func TestDoCancelled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	calls := 0
+	err := Policy{MaxAttempts: 5, InitialInterval: time.Hour}.Do(ctx, func(context.Context) error {
+		calls++
+		cancel()
+		return errors.New("transient")
+	}, nil)
+	if err == nil || calls != 1 {
+		t.Errorf("Do() = %v after %d calls,want an error after 1", err, calls)
+	}
+}
@@ -0,0 +1,171 @@
+package source
+
+import (
+	"archive/tar"
+	"bufio"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+)
+
+// archive gives access to the files of a docker save tarball or an OCI layout,
+// which may be a directory or a (gzip compressed) tarball
+type archive interface {
+	Open(name string) (io.ReadCloser, error)
+	Size(name string) (int64, error)
+	Close() error
+}
+
+func openArchive(p string) (archive, error) {
+	fi, err := os.Stat(p)
+	if err != nil {
+		return nil, err
+	}
+	if fi.IsDir() {
+		return dirArchive(p), nil
+	}
+	return newTarArchive(p)
+}
+
+func readArchiveFile(a archive, name string) ([]byte, error) {
+	r, err := a.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+	return ioutil.ReadAll(r)
+}
+
+type dirArchive string
+
+func (d dirArchive) Open(name string) (io.ReadCloser, error) {
+	return os.Open(filepath.Join(string(d), filepath.FromSlash(name)))
+}
+
+func (d dirArchive) Close() error {
+	return nil
+}
+
+func (d dirArchive) Size(name string) (int64, error) {
+	fi, err := os.Stat(filepath.Join(string(d), filepath.FromSlash(name)))
+	if err != nil {
+		return 0, err
+	}
+	return fi.Size(), nil
+}
+
+// tarArchive reads entries of a tarball. The offsets of the entries are indexed once,
+// Open reads an entry in place without scanning the tarball again. A gzip tarball
+// is decompressed once into a temp file,removed by Close.
+type tarArchive struct {
+	path    string
+	f       *os.File
+	temp    bool
+	entries map[string]tarEntry
+}
+
+type tarEntry struct {
+	offset int64
+	size   int64
+}
+
+func newTarArchive(p string) (*tarArchive, error) {
+	f, err := os.Open(p)
+	if err != nil {
+		return nil, err
+	}
+	a := &tarArchive{path: p, f: f, entries: make(map[string]tarEntry)}
+	magic := make([]byte, 2)
+	if _, err := io.ReadFull(f, magic); err != nil {
+		f.Close()
+		return nil, fmt.Errorf("read tarball %s err %v", p, err)
+	}
+	if magic[0] == 0x1f && magic[1] == 0x8b {
+		err = a.decompress()
+	} else {
+		_, err = f.Seek(0, io.SeekStart)
+	}
+	if err == nil {
+		err = a.index()
+	}
+	if err != nil {
+		a.Close()
+		return nil, err
+	}
+	return a, nil
+}
+
+// decompress replaces a.f by a temp file with the uncompressed tarball
+func (a *tarArchive) decompress() error {
+	if _, err := a.f.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+	gz, err := gzip.NewReader(bufio.NewReader(a.f))
+	if err != nil {
+		return fmt.Errorf("open gzip tarball %s err %v", a.path, err)
+	}
+	tmp, err := ioutil.TempFile("", "clair-client-archive-*.tar")
+	if err != nil {
+		return err
+	}
+	src := a.f
+	defer src.Close()
+	a.f, a.temp = tmp, true
+	if _, err := io.Copy(tmp, gz); err != nil {
+		return fmt.Errorf("decompress tarball %s err %v", a.path, err)
+	}
+	_, err = tmp.Seek(0, io.SeekStart)
+	return err
+}
+
+// index records where the content of every regular file starts. The tar reader reads the
+// headers from a.f and seeks over the contents,so the file offset after Next is the content start.
+func (a *tarArchive) index() error {
+	tr := tar.NewReader(a.f)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("read tarball %s err %v", a.path, err)
+		}
+		if hdr.Typeflag != tar.TypeReg {
+			continue
+		}
+		offset, err := a.f.Seek(0, io.SeekCurrent)
+		if err != nil {
+			return err
+		}
+		a.entries[path.Clean(hdr.Name)] = tarEntry{offset: offset, size: hdr.Size}
+	}
+}
+
+func (a *tarArchive) Open(name string) (io.ReadCloser, error) {
+	e, ok := a.entries[path.Clean(name)]
+	if !ok {
+		return nil, fmt.Errorf("%s not found in %s", name, a.path)
+	}
+	// ReadAt does not move the file offset,entries can be read concurrently
+	return ioutil.NopCloser(io.NewSectionReader(a.f, e.offset, e.size)), nil
+}
+
+func (a *tarArchive) Size(name string) (int64, error) {
+	e, ok := a.entries[path.Clean(name)]
+	if !ok {
+		return 0, fmt.Errorf("%s not found in %s", name, a.path)
+	}
+	return e.size, nil
+}
+
+func (a *tarArchive) Close() error {
+	err := a.f.Close()
+	if a.temp {
+		os.Remove(a.f.Name())
+	}
+	return err
+}
@@ -0,0 +1,107 @@
+package source
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func writeTarball(t *testing.T, compress bool, files map[string]string, order []string) string {
+	t.Helper()
+	var buf bytes.Buffer
+	var w io.Writer = &buf
+	var gz *gzip.Writer
+	if compress {
+		gz = gzip.NewWriter(&buf)
+		w = gz
+	}
+	tw := tar.NewWriter(w)
+	for _, name := range order {
+		if strings.HasSuffix(name, "/") {
+			if err := tw.WriteHeader(&tar.Header{Name: name, Typeflag: tar.TypeDir, Mode: 0755}); err != nil {
+				t.Fatal(err)
+			}
+			continue
+		}
+		content := files[name]
+		if err := tw.WriteHeader(&tar.Header{Name: name, Typeflag: tar.TypeReg, Mode: 0644, Size: int64(len(content))}); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := tw.Write([]byte(content)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if gz != nil {
+		if err := gz.Close(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	p := filepath.Join(t.TempDir(), "image.tar")
+	if err := ioutil.WriteFile(p, buf.Bytes(), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return p
+}
+
+func TestTarArchive(t *testing.T) {
+	files := map[string]string{
+		"manifest.json":   `[{"Config":"config.json"}]`,
+		"config.json":     `{}`,
+		"abc/layer.tar":   strings.Repeat("a", 1000),
+		"./def/layer.tar": strings.Repeat("d", 513),
+		"empty":           "",
+	}
+	order := []string{"manifest.json", "abc/", "abc/layer.tar", "config.json", "def/", "./def/layer.tar", "empty"}
+	tests := []struct {
+		name     string
+		compress bool
+	}{
+		{"tar", false},
+		{"tar.gz", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a, err := newTarArchive(writeTarball(t, tt.compress, files, order))
+			if err != nil {
+				t.Fatal(err)
+			}
+			// read out of order and twice,entries do not depend on each other
+			for _, name := range []string{"empty", "def/layer.tar", "abc/layer.tar", "manifest.json", "def/layer.tar", "config.json"} {
+				want := files[name]
+				if want == "" && name != "empty" {
+					want = files["./"+name]
+				}
+				data, err := readArchiveFile(a, name)
+				if err != nil || string(data) != want {
+					t.Errorf("Open(%s) = %q,%v,want %q", name, data, err, want)
+				}
+				if size, err := a.Size(name); err != nil || size != int64(len(want)) {
+					t.Errorf("Size(%s) = %d,%v,want %d", name, size, err, len(want))
+				}
+			}
+			if _, err := a.Open("abc"); err == nil {
+				t.Error("Open of a directory succeeded")
+			}
+			if _, err := a.Open("missing"); err == nil {
+				t.Error("Open of a missing file succeeded")
+			}
+
+			tmp := a.f.Name()
+			if err := a.Close(); err != nil {
+				t.Fatal(err)
+			}
+			if _, err := os.Stat(tmp); tt.compress != os.IsNotExist(err) {
+				t.Errorf("after Close stat %s = %v", tmp, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,152 @@
+package source
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// dockerArchiveManifest is an entry of manifest.json in a docker save tarball
+type dockerArchiveManifest struct {
+	Config   string   `json:"Config"`
+	RepoTags []string `json:"RepoTags"`
+	Layers   []string `json:"Layers"`
+}
+
+type imageConfig struct {
+	RootFS struct {
+		DiffIDs []string `json:"diff_ids"`
+	} `json:"rootfs"`
+}
+
+// DockerArchiveSource reads an image from a "docker save" tarball
+type DockerArchiveSource struct {
+	path    string
+	tag     string
+	archive archive
+	// layer digest -> file in the archive
+	files map[string]string
+	// layers of the image,see Layers
+	layers []Layer
+}
+
+// NewDockerArchiveSource opens a docker save tarball. tag selects the image if the tarball
+// contains several,empty means the first one.
+func NewDockerArchiveSource(path, tag string) (*DockerArchiveSource, error) {
+	a, err := openArchive(path)
+	if err != nil {
+		return nil, fmt.Errorf("open docker archive %s err %v", path, err)
+	}
+	return &DockerArchiveSource{
+		path:    path,
+		tag:     tag,
+		archive: a,
+		files:   make(map[string]string),
+	}, nil
+}
+
+func (s *DockerArchiveSource) Reference() string {
+	if s.tag != "" {
+		return fmt.Sprintf("docker-archive:%s:%s", s.path, s.tag)
+	}
+	return "docker-archive:" + s.path
+}
+
+// Layers reads the layers of the image once,later calls return the same layers. A digest repeated
+// in the manifest,like an empty layer older docker versions name by its diff id,stays in the list.
+func (s *DockerArchiveSource) Layers(ctx context.Context) ([]Layer, error) {
+	if s.layers != nil {
+		return s.layers, nil
+	}
+	data, err := readArchiveFile(s.archive, "manifest.json")
+	if err != nil {
+		return nil, fmt.Errorf("read manifest.json of %s err %v", s.path, err)
+	}
+	var manifests []dockerArchiveManifest
+	if err := json.Unmarshal(data, &manifests); err != nil {
+		return nil, fmt.Errorf("parse manifest.json of %s err %v", s.path, err)
+	}
+	m, err := s.selectManifest(manifests)
+	if err != nil {
+		return nil, err
+	}
+
+	data, err = readArchiveFile(s.archive, m.Config)
+	if err != nil {
+		return nil, fmt.Errorf("read image config %s err %v", m.Config, err)
+	}
+	var cfg imageConfig
+	if err := json.Unmarshal(data, &cfg); err != nil {
+		return nil, fmt.Errorf("parse image config %s err %v", m.Config, err)
+	}
+
+	layers := make([]Layer, 0, len(m.Layers))
+	for i, file := range m.Layers {
+		// docker >= 25 writes OCI style blobs/sha256/<hex> paths, older versions <id>/layer.tar
+		// where the id is not a content digest,so name those layers by their diff id
+		dg := blobPathDigest(file)
+		if dg == "" {
+			if i >= len(cfg.RootFS.DiffIDs) {
+				return nil, fmt.Errorf("image config %s has no diff id for layer %s", m.Config, file)
+			}
+			dg = cfg.RootFS.DiffIDs[i]
+		}
+		size, err := s.archive.Size(file)
+		if err != nil {
+			return nil, err
+		}
+		// same digest,same content. any of the files serves the layer
+		s.files[dg] = file
+		layers = append(layers, Layer{Digest: dg, Size: size})
+	}
+	s.layers = layers
+	return layers, nil
+}
+
+func (s *DockerArchiveSource) selectManifest(manifests []dockerArchiveManifest) (dockerArchiveManifest, error) {
+	if len(manifests) == 0 {
+		return dockerArchiveManifest{}, fmt.Errorf("no image in %s", s.path)
+	}
+	if s.tag == "" {
+		return manifests[0], nil
+	}
+	for _, m := range manifests {
+		for _, t := range m.RepoTags {
+			if t == s.tag || strings.HasSuffix(t, ":"+s.tag) {
+				return m, nil
+			}
+		}
+	}
+	return dockerArchiveManifest{}, fmt.Errorf("image %s not found in %s", s.tag, s.path)
+}
+
+func (s *DockerArchiveSource) OpenLayer(ctx context.Context, layer Layer) (io.ReadCloser, error) {
+	file, ok := s.files[layer.Digest]
+	if !ok {
+		return nil, fmt.Errorf("layer %s not found in %s", layer.Digest, s.path)
+	}
+	return s.archive.Open(file)
+}
+
+func (s *DockerArchiveSource) Close() error {
+	return s.archive.Close()
+}
+
+// blobPathDigest returns sha256:<hex> for blobs/sha256/<hex>,"" otherwise
+func blobPathDigest(p string) string {
+	parts := strings.Split(p, "/")
+	if len(parts) == 3 && parts[0] == "blobs" {
+		return parts[1] + ":" + parts[2]
+	}
+	return ""
+}
+
+func digestBlobPath(dg string) string {
+	parts := strings.SplitN(dg, ":", 2)
+	if len(parts) != 2 {
+		return ""
+	}
+	return "blobs/" + parts[0] + "/" + parts[1]
+}
@@ -0,0 +1,48 @@
+package source
+
+import (
+	"context"
+	"io/ioutil"
+	"reflect"
+	"testing"
+)
+
+func TestDockerArchiveRepeatedLayer(t *testing.T) {
+	// docker < 25 names layers <id>/layer.tar,an empty layer added twice has the same diff id
+	files := map[string]string{
+		"manifest.json": `[{"Config":"config.json","RepoTags":["alpine:3.12"],"Layers":["a/layer.tar","e1/layer.tar","e2/layer.tar"]}]`,
+		"config.json":   `{"rootfs":{"diff_ids":["sha256:aa","sha256:ee","sha256:ee"]}}`,
+		"a/layer.tar":   "aaa",
+		"e1/layer.tar":  "",
+		"e2/layer.tar":  "",
+	}
+	order := []string{"manifest.json", "config.json", "a/layer.tar", "e1/layer.tar", "e2/layer.tar"}
+	s, err := NewDockerArchiveSource(writeTarball(t, false, files, order), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	want := []Layer{{Digest: "sha256:aa", Size: 3}, {Digest: "sha256:ee", Size: 0}, {Digest: "sha256:ee", Size: 0}}
+	// the scan reads the layers once for the image and again to post them
+	for i := 0; i < 2; i++ {
+		layers, err := s.Layers(context.Background())
+		if err != nil {
+			t.Fatalf("Layers() call %d err %v", i+1, err)
+		}
+		if !reflect.DeepEqual(layers, want) {
+			t.Errorf("Layers() call %d = %+v,want %+v", i+1, layers, want)
+		}
+	}
+	for _, l := range want {
+		r, err := s.OpenLayer(context.Background(), l)
+		if err != nil {
+			t.Fatal(err)
+		}
+		data, err := ioutil.ReadAll(r)
+		r.Close()
+		if err != nil || int64(len(data)) != l.Size {
+			t.Errorf("OpenLayer(%s) read %q,%v,want %d bytes", l.Digest, data, err, l.Size)
+		}
+	}
+}
@@ -0,0 +1,156 @@
+package source
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"runtime"
+)
+
+const (
+	ociRefNameAnnotation = "org.opencontainers.image.ref.name"
+
+	mediaTypeOCIIndex           = "application/vnd.oci.image.index.v1+json"
+	mediaTypeDockerManifestList = "application/vnd.docker.distribution.manifest.list.v2+json"
+)
+
+type ociDescriptor struct {
+	MediaType   string            `json:"mediaType"`
+	Digest      string            `json:"digest"`
+	Size        int64             `json:"size"`
+	Annotations map[string]string `json:"annotations,omitempty"`
+	Platform    *struct {
+		Architecture string `json:"architecture"`
+		OS           string `json:"os"`
+	} `json:"platform,omitempty"`
+}
+
+// ociIndex is index.json or a nested image index
+type ociIndex struct {
+	MediaType string          `json:"mediaType"`
+	Manifests []ociDescriptor `json:"manifests"`
+}
+
+type ociManifest struct {
+	Config ociDescriptor   `json:"config"`
+	Layers []ociDescriptor `json:"layers"`
+}
+
+// OCILayoutSource reads an image from an OCI image layout directory or tarball
+type OCILayoutSource struct {
+	path    string
+	ref     string
+	archive archive
+	sizes   map[string]int64
+	// layers of the image,see Layers
+	layers []Layer
+}
+
+// NewOCILayoutSource opens an OCI image layout. ref selects the manifest by its
+// org.opencontainers.image.ref.name annotation, empty means the first one.
+func NewOCILayoutSource(path, ref string) (*OCILayoutSource, error) {
+	a, err := openArchive(path)
+	if err != nil {
+		return nil, fmt.Errorf("open oci layout %s err %v", path, err)
+	}
+	return &OCILayoutSource{
+		path:    path,
+		ref:     ref,
+		archive: a,
+		sizes:   make(map[string]int64),
+	}, nil
+}
+
+func (s *OCILayoutSource) Reference() string {
+	if s.ref != "" {
+		return fmt.Sprintf("oci:%s:%s", s.path, s.ref)
+	}
+	return "oci:" + s.path
+}
+
+// Layers reads the layers of the image once,later calls return the same layers.
+// A digest repeated in the manifest stays in the list.
+func (s *OCILayoutSource) Layers(ctx context.Context) ([]Layer, error) {
+	if s.layers != nil {
+		return s.layers, nil
+	}
+	if _, err := s.archive.Size("oci-layout"); err != nil {
+		return nil, fmt.Errorf("%s is not an oci image layout: %v", s.path, err)
+	}
+	var index ociIndex
+	if err := s.readJSON("index.json", &index); err != nil {
+		return nil, err
+	}
+	desc, err := s.selectManifest(index)
+	if err != nil {
+		return nil, err
+	}
+
+	var manifest ociManifest
+	if err := s.readJSON(digestBlobPath(desc.Digest), &manifest); err != nil {
+		return nil, err
+	}
+
+	layers := make([]Layer, 0, len(manifest.Layers))
+	for _, l := range manifest.Layers {
+		s.sizes[l.Digest] = l.Size
+		layers = append(layers, Layer{Digest: l.Digest, Size: l.Size})
+	}
+	s.layers = layers
+	return layers, nil
+}
+
+// selectManifest picks the image manifest from index.json,following one level of
+// nested image index (multi-arch images) and preferring linux on the current architecture
+func (s *OCILayoutSource) selectManifest(index ociIndex) (ociDescriptor, error) {
+	var desc *ociDescriptor
+	for i, m := range index.Manifests {
+		if s.ref == "" || m.Annotations[ociRefNameAnnotation] == s.ref {
+			desc = &index.Manifests[i]
+			break
+		}
+	}
+	if desc == nil {
+		return ociDescriptor{}, fmt.Errorf("manifest %s not found in %s", s.ref, s.path)
+	}
+	if desc.MediaType != mediaTypeOCIIndex && desc.MediaType != mediaTypeDockerManifestList {
+		return *desc, nil
+	}
+
+	var nested ociIndex
+	if err := s.readJSON(digestBlobPath(desc.Digest), &nested); err != nil {
+		return ociDescriptor{}, err
+	}
+	if len(nested.Manifests) == 0 {
+		return ociDescriptor{}, fmt.Errorf("image index %s in %s is empty", desc.Digest, s.path)
+	}
+	for _, m := range nested.Manifests {
+		if m.Platform != nil && m.Platform.OS == "linux" && m.Platform.Architecture == runtime.GOARCH {
+			return m, nil
+		}
+	}
+	return nested.Manifests[0], nil
+}
+
+func (s *OCILayoutSource) readJSON(name string, v interface{}) error {
+	data, err := readArchiveFile(s.archive, name)
+	if err != nil {
+		return fmt.Errorf("read %s of %s err %v", name, s.path, err)
+	}
+	if err := json.Unmarshal(data, v); err != nil {
+		return fmt.Errorf("parse %s of %s err %v", name, s.path, err)
+	}
+	return nil
+}
+
+func (s *OCILayoutSource) OpenLayer(ctx context.Context, layer Layer) (io.ReadCloser, error) {
+	if _, ok := s.sizes[layer.Digest]; !ok {
+		return nil, fmt.Errorf("layer %s not found in %s", layer.Digest, s.path)
+	}
+	return s.archive.Open(digestBlobPath(layer.Digest))
+}
+
+func (s *OCILayoutSource) Close() error {
+	return s.archive.Close()
+}
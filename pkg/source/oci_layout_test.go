@@ -0,0 +1,37 @@
+package source
+
+import (
+	"context"
+	"reflect"
+	"testing"
+)
+
+func TestOCILayoutRepeatedLayer(t *testing.T) {
+	files := map[string]string{
+		"oci-layout":      `{"imageLayoutVersion":"1.0.0"}`,
+		"index.json":      `{"manifests":[{"mediaType":"application/vnd.oci.image.manifest.v1+json","digest":"sha256:m"}]}`,
+		"blobs/sha256/m":  `{"layers":[{"digest":"sha256:aa","size":3},{"digest":"sha256:ee","size":32},{"digest":"sha256:ee","size":32}]}`,
+		"blobs/sha256/aa": "aaa",
+		"blobs/sha256/ee": "",
+	}
+	order := []string{"oci-layout", "index.json", "blobs/sha256/m", "blobs/sha256/aa", "blobs/sha256/ee"}
+	s, err := NewOCILayoutSource(writeTarball(t, false, files, order), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	want := []Layer{{Digest: "sha256:aa", Size: 3}, {Digest: "sha256:ee", Size: 32}, {Digest: "sha256:ee", Size: 32}}
+	for i := 0; i < 2; i++ {
+		layers, err := s.Layers(context.Background())
+		if err != nil {
+			t.Fatalf("Layers() call %d err %v", i+1, err)
+		}
+		if !reflect.DeepEqual(layers, want) {
+			t.Errorf("Layers() call %d = %+v,want %+v", i+1, layers, want)
+		}
+	}
+	if _, err := s.OpenLayer(context.Background(), want[2]); err != nil {
+		t.Errorf("OpenLayer(%s) err %v", want[2].Digest, err)
+	}
+}
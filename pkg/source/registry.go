@@ -0,0 +1,112 @@
+package source
+
+import (
+	"context"
+	"fmt"
+	"io"
+
+	"github.com/opencontainers/go-digest"
+	"github.com/wadeling/clair-client/pkg/registry-wrap"
+	"github.com/wadeling/clair-client/pkg/tracing"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// RegistrySource reads image layers from a docker registry
+type RegistrySource struct {
+	client     *registryWrap.RegistryClient
+	repository string
+	tag        string
+
+	ImageDigest digest.Digest
+	// layers of ImageDigest,see Layers
+	layers []Layer
+}
+
+func NewRegistrySource(client *registryWrap.RegistryClient, repository, tag string) *RegistrySource {
+	return &RegistrySource{
+		client:     client,
+		repository: repository,
+		tag:        tag,
+	}
+}
+
+func (s *RegistrySource) Reference() string {
+	if s.ImageDigest != "" {
+		return fmt.Sprintf("%s:%s@%s", s.repository, s.tag, s.ImageDigest)
+	}
+	return fmt.Sprintf("%s:%s", s.repository, s.tag)
+}
+
+// Layers resolves the tag to ImageDigest and returns the layers of its manifest. The tag is
+// resolved once,later calls return the same layers even if the tag was pushed again meanwhile.
+func (s *RegistrySource) Layers(ctx context.Context) (layers []Layer, err error) {
+	if s.layers != nil {
+		return s.layers, nil
+	}
+	_, span := tracing.Start(ctx, "registry.manifest",
+		attribute.String("repository", s.repository), attribute.String("tag", s.tag))
+	defer func() { tracing.End(span, err) }()
+
+	dg, err := s.client.GetManifestDigest(s.repository, s.tag)
+	if err != nil {
+		return nil, err
+	}
+	s.ImageDigest = dg
+	span.SetAttributes(attribute.String("digest", dg.String()))
+
+	infos, err := s.client.GetManifestLayers(s.repository, dg.String())
+	if err != nil {
+		return nil, err
+	}
+	layers = make([]Layer, 0, len(infos))
+	for _, l := range infos {
+		layers = append(layers, Layer{Digest: l.Digest, Size: l.Size})
+	}
+	s.layers = layers
+	return layers, nil
+}
+
+// OpenLayer starts the blob download,its span ends when the returned reader is closed
+func (s *RegistrySource) OpenLayer(ctx context.Context, layer Layer) (io.ReadCloser, error) {
+	ctx, span := tracing.Start(ctx, "registry.blob.download",
+		attribute.String("repository", s.repository), attribute.String("digest", layer.Digest))
+	r, err := s.client.DownloadBlob(ctx, s.repository, digest.Digest(layer.Digest))
+	if err != nil {
+		tracing.End(span, err)
+		return nil, err
+	}
+	return &tracedReader{ReadCloser: r, span: span}, nil
+}
+
+// tracedReader ends the download span on close
+type tracedReader struct {
+	io.ReadCloser
+	span  trace.Span
+	bytes int64
+}
+
+func (r *tracedReader) Read(p []byte) (int, error) {
+	n, err := r.ReadCloser.Read(p)
+	r.bytes += int64(n)
+	return n, err
+}
+
+func (r *tracedReader) Close() error {
+	err := r.ReadCloser.Close()
+	r.span.SetAttributes(attribute.Int64("bytes", r.bytes))
+	tracing.End(r.span, nil)
+	return err
+}
+
+func (s *RegistrySource) LayerURL(layer Layer) string {
+	return s.client.BlobURL(s.repository, digest.Digest(layer.Digest))
+}
+
+func (s *RegistrySource) LayerHeaders(ctx context.Context, layer Layer) (map[string]string, error) {
+	return s.client.BlobHeaders(s.repository, digest.Digest(layer.Digest))
+}
+
+func (s *RegistrySource) Close() error {
+	return nil
+}
@@ -0,0 +1,142 @@
+package source
+
+import (
+	"archive/tar"
+	"context"
+	"crypto/sha256"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/opencontainers/go-digest"
+)
+
+// RootfsSource scans an unpacked root filesystem (VM image,distroless build output...)
+// as a single synthetic layer without parent. The directory is tarred on the fly,
+// once to compute the layer digest and again whenever the layer is opened.
+type RootfsSource struct {
+	dir   string
+	layer Layer
+}
+
+func NewRootfsSource(dir string) (*RootfsSource, error) {
+	fi, err := os.Stat(dir)
+	if err != nil {
+		return nil, err
+	}
+	if !fi.IsDir() {
+		return nil, fmt.Errorf("rootfs %s is not a directory", dir)
+	}
+	return &RootfsSource{dir: dir}, nil
+}
+
+func (s *RootfsSource) Reference() string {
+	return "rootfs:" + s.dir
+}
+
+func (s *RootfsSource) Layers(ctx context.Context) ([]Layer, error) {
+	if s.layer.Digest == "" {
+		h := sha256.New()
+		cw := &countingWriter{w: h}
+		if err := writeRootfsTar(ctx, s.dir, cw); err != nil {
+			return nil, fmt.Errorf("tar rootfs %s err %v", s.dir, err)
+		}
+		s.layer = Layer{
+			Digest: digest.NewDigest(digest.SHA256, h).String(),
+			Size:   cw.n,
+		}
+	}
+	return []Layer{s.layer}, nil
+}
+
+func (s *RootfsSource) OpenLayer(ctx context.Context, layer Layer) (io.ReadCloser, error) {
+	if layer.Digest != s.layer.Digest {
+		return nil, fmt.Errorf("layer %s not found in %s", layer.Digest, s.Reference())
+	}
+	pr, pw := io.Pipe()
+	go func() {
+		pw.CloseWithError(writeRootfsTar(ctx, s.dir, pw))
+	}()
+	return pr, nil
+}
+
+func (s *RootfsSource) Close() error {
+	return nil
+}
+
+// writeRootfsTar writes dir as a tar stream. filepath.Walk visits files in lexical order and
+// times and owners are zeroed,so the output and therefore the layer digest only change with
+// the names,modes and contents of the files.
+func writeRootfsTar(ctx context.Context, dir string, w io.Writer) error {
+	tw := tar.NewWriter(w)
+	err := filepath.Walk(dir, func(p string, fi os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(dir, p)
+		if err != nil {
+			return err
+		}
+		if rel == "." {
+			return nil
+		}
+		if fi.Mode()&os.ModeSocket != 0 {
+			// sockets can not be stored in a tar
+			return nil
+		}
+
+		link := ""
+		if fi.Mode()&os.ModeSymlink != 0 {
+			if link, err = os.Readlink(p); err != nil {
+				return err
+			}
+		}
+		hdr, err := tar.FileInfoHeader(fi, link)
+		if err != nil {
+			return err
+		}
+		hdr.Name = filepath.ToSlash(rel)
+		hdr.ModTime = time.Unix(0, 0)
+		hdr.AccessTime = time.Time{}
+		hdr.ChangeTime = time.Time{}
+		hdr.Uid, hdr.Gid = 0, 0
+		hdr.Uname, hdr.Gname = "", ""
+		if fi.IsDir() {
+			hdr.Name += "/"
+		}
+		if err := tw.WriteHeader(hdr); err != nil {
+			return err
+		}
+		if !fi.Mode().IsRegular() {
+			return nil
+		}
+
+		f, err := os.Open(p)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		_, err = io.Copy(tw, f)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	return tw.Close()
+}
+
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (c *countingWriter) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	c.n += int64(n)
+	return n, err
+}
@@ -0,0 +1,86 @@
+package source
+
+import (
+	"archive/tar"
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func rootfsDigest(t *testing.T, dir string) ([sha256.Size]byte, []*tar.Header) {
+	t.Helper()
+	var buf bytes.Buffer
+	if err := writeRootfsTar(context.Background(), dir, &buf); err != nil {
+		t.Fatal(err)
+	}
+	sum := sha256.Sum256(buf.Bytes())
+	var headers []*tar.Header
+	tr := tar.NewReader(&buf)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		headers = append(headers, hdr)
+	}
+	return sum, headers
+}
+
+func TestWriteRootfsTarDeterministic(t *testing.T) {
+	dir := t.TempDir()
+	for name, content := range map[string]string{"etc/os-release": "ID=alpine\n", "bin/sh": "#!", "a": "a"} {
+		p := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(p), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(p, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.Symlink("bin/sh", filepath.Join(dir, "sh")); err != nil {
+		t.Fatal(err)
+	}
+
+	first, headers := rootfsDigest(t, dir)
+	var names []string
+	for _, hdr := range headers {
+		names = append(names, hdr.Name)
+		if !hdr.ModTime.Equal(time.Unix(0, 0)) || hdr.Uid != 0 || hdr.Gid != 0 || hdr.Uname != "" || hdr.Gname != "" {
+			t.Errorf("%s has mtime %v,owner %d:%d %q:%q,want zeroed", hdr.Name, hdr.ModTime, hdr.Uid, hdr.Gid, hdr.Uname, hdr.Gname)
+		}
+		if hdr.Name == "sh" && (hdr.Typeflag != tar.TypeSymlink || hdr.Linkname != "bin/sh") {
+			t.Errorf("sh is type %c link %q,want a symlink to bin/sh", hdr.Typeflag, hdr.Linkname)
+		}
+	}
+	if want := []string{"a", "bin/", "bin/sh", "etc/", "etc/os-release", "sh"}; !reflect.DeepEqual(names, want) {
+		t.Errorf("entries = %v,want %v", names, want)
+	}
+
+	// touching files does not change the layer
+	later := time.Now().Add(time.Hour)
+	for _, name := range []string{"a", "bin", "etc/os-release"} {
+		if err := os.Chtimes(filepath.Join(dir, name), later, later); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if second, _ := rootfsDigest(t, dir); second != first {
+		t.Error("digest changed after touching files")
+	}
+
+	if err := ioutil.WriteFile(filepath.Join(dir, "etc/os-release"), []byte("ID=debian\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if changed, _ := rootfsDigest(t, dir); changed == first {
+		t.Error("digest did not change with the content of a file")
+	}
+}
@@ -0,0 +1,35 @@
+package source
+
+import (
+	"context"
+	"io"
+)
+
+// Layer is one layer of an image to be scanned by clair
+type Layer struct {
+	// Digest names the layer in clair and in the file server,like sha256:xxx
+	Digest string
+	// Size of the layer blob in bytes,-1 if unknown
+	Size int64
+}
+
+// ImageSource provides the layers of an image, either from a registry or from local files.
+type ImageSource interface {
+	// Reference describes the image,only used for logging and reports
+	Reference() string
+	// Layers returns the image layers in apply order,base layer first
+	Layers(ctx context.Context) ([]Layer, error)
+	// OpenLayer opens the layer tar (may be gzip compressed,clair detects it)
+	OpenLayer(ctx context.Context, layer Layer) (io.ReadCloser, error)
+	Close() error
+}
+
+// DirectSource is an ImageSource clair can download layers from itself,
+// so they do not need to go through the local file server
+type DirectSource interface {
+	ImageSource
+	// LayerURL returns the url of the layer blob,it needs no request
+	LayerURL(layer Layer) string
+	// LayerHeaders returns fresh headers to download the layer blob,like a short lived token
+	LayerHeaders(ctx context.Context, layer Layer) (map[string]string, error)
+}
@@ -1,4 +1,7 @@
 #!/bin/bash
-#./test -clair-ip "localhost" -clair-port 6060 -user admin -password "Harbor12345" -url "http://192.168.208.79:80" -repo test -image test -tag nginx_1.15
-#./test -clair-ip "localhost" -clair-port 6060 -user admin -password "Harbor12345" -url "http://192.168.208.79:80" -repo test -image test -tag nginx-1.20
-./test -clair-ip "localhost" -clair-port 6060 -user admin -password "Harbor12345" -url "http://192.168.208.79:80" -repo test -image test -tag redis-6.2.2
+# registry credentials are read from ~/.docker/config.json (docker login), or from env:
+#   export CLAIR_CLIENT_REGISTRY_USERNAME=admin CLAIR_CLIENT_REGISTRY_PASSWORD=xxx
+#./test scan -clair-ip "localhost" -clair-port 6060 -url "http://192.168.208.79:80" -repo test -image test -tag nginx_1.15
+#./test scan -clair-ip "localhost" -clair-port 6060 -url "http://192.168.208.79:80" -repo test -image test -tag nginx-1.20
+#./test scan -clair-ip "localhost" -clair-port 6060 -url "https://registry-1.docker.io" -repo library -image redis -tag 6.2.2
+./test scan -clair-ip "localhost" -clair-port 6060 -url "http://192.168.208.79:80" -repo test -image test -tag redis-6.2.2
@@ -3,21 +3,88 @@ package util
 import (
 	"fmt"
 	"net"
+	"strconv"
+	"strings"
 )
 
+// GetLocalIp returns the first non-loopback address of an interface that is up,
+// ipv4 preferred,a global ipv6 address on ipv6-only hosts
 func GetLocalIp() (string,error) {
-	addrs, err := net.InterfaceAddrs()
+	ifaces, err := net.Interfaces()
 	if err != nil {
 		return "",err
 	}
 
-	for _, address := range addrs {
-		if ipnet, ok := address.(*net.IPNet); ok && !ipnet.IP.IsLoopback() {
+	var v6 string
+	for _, iface := range ifaces {
+		if iface.Flags&net.FlagUp == 0 || iface.Flags&net.FlagLoopback != 0 {
+			continue
+		}
+		addrs, err := iface.Addrs()
+		if err != nil {
+			continue
+		}
+		for _, address := range addrs {
+			ipnet, ok := address.(*net.IPNet)
+			if !ok || ipnet.IP.IsLoopback() {
+				continue
+			}
 			if ipnet.IP.To4() != nil {
 				return ipnet.IP.String(),nil
 			}
+			if v6 == "" && ipnet.IP.IsGlobalUnicast() {
+				v6 = ipnet.IP.String()
+			}
 		}
 	}
+	if v6 != "" {
+		return v6,nil
+	}
 	return "",fmt.Errorf("not find ip")
 }
 
+// GetRouteIp returns the local address of the interface routing to host,
+// e.g. the address the clair host reaches us at. No packet is sent.
+func GetRouteIp(host string) (string,error) {
+	ips, err := net.LookupIP(TrimBrackets(host))
+	if err != nil {
+		return "",err
+	}
+	if len(ips) == 0 {
+		return "",fmt.Errorf("no address for host %s",host)
+	}
+	// udp "connect" only selects the route
+	conn, err := net.Dial("udp", net.JoinHostPort(ips[0].String(), "9"))
+	if err != nil {
+		return "",fmt.Errorf("no route to %s: %v",host,err)
+	}
+	defer conn.Close()
+	return conn.LocalAddr().(*net.UDPAddr).IP.String(),nil
+}
+
+// ParseAdvertiseAddr splits an advertised address into host and optional port (0 if absent).
+// The host is a hostname or an ip,ipv6 with or without brackets: "clair-client",
+// "10.0.0.5:8080", "fd00::5", "[fd00::5]:8080".
+func ParseAdvertiseAddr(addr string) (string,int,error) {
+	if addr == "" {
+		return "",0,fmt.Errorf("empty address")
+	}
+	host, portStr, err := net.SplitHostPort(addr)
+	if err != nil {
+		// no port,a bare ipv6 address has several colons
+		return TrimBrackets(addr),0,nil
+	}
+	port, err := strconv.Atoi(portStr)
+	if err != nil || port <= 0 || port > 65535 {
+		return "",0,fmt.Errorf("invalid port in address %s",addr)
+	}
+	if host == "" {
+		return "",0,fmt.Errorf("missing host in address %s",addr)
+	}
+	return host,port,nil
+}
+
+// TrimBrackets removes the brackets around an ipv6 address like [::1]
+func TrimBrackets(host string) string {
+	return strings.TrimSuffix(strings.TrimPrefix(host, "["), "]")
+}
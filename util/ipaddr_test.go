@@ -0,0 +1,36 @@
+package util
+
+import "testing"
+
+func TestParseAdvertiseAddr(t *testing.T) {
+	tests := []struct {
+		addr     string
+		wantHost string
+		wantPort int
+		wantErr  bool
+	}{
+		{addr: "clair-client", wantHost: "clair-client"},
+		{addr: "10.0.0.5", wantHost: "10.0.0.5"},
+		{addr: "10.0.0.5:8080", wantHost: "10.0.0.5", wantPort: 8080},
+		{addr: "scanner.example.com:5566", wantHost: "scanner.example.com", wantPort: 5566},
+		{addr: "fd00::5", wantHost: "fd00::5"},
+		{addr: "[fd00::5]", wantHost: "fd00::5"},
+		{addr: "[fd00::5]:8080", wantHost: "fd00::5", wantPort: 8080},
+		{addr: "", wantErr: true},
+		{addr: ":8080", wantErr: true},
+		{addr: "10.0.0.5:0", wantErr: true},
+		{addr: "10.0.0.5:65536", wantErr: true},
+		{addr: "10.0.0.5:http", wantErr: true},
+		{addr: "10.0.0.5:", wantErr: true},
+	}
+	for _, tt := range tests {
+		host, port, err := ParseAdvertiseAddr(tt.addr)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("ParseAdvertiseAddr(%q) err %v,wantErr %v", tt.addr, err, tt.wantErr)
+			continue
+		}
+		if host != tt.wantHost || port != tt.wantPort {
+			t.Errorf("ParseAdvertiseAddr(%q) = %s,%d,want %s,%d", tt.addr, host, port, tt.wantHost, tt.wantPort)
+		}
+	}
+}